@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Valeurs par défaut de la planification adaptative
+const (
+	DefaultAdaptiveLookbackWeeks = 8             // Semaines d'historique prises en compte
+	adaptiveMinObservations      = 20            // Nombre d'apparitions en dessous duquel l'intervalle fixe est gardé
+	adaptivePlanRefresh          = time.Hour     // Délai avant de recalculer les intervalles d'une agence
+	hoursPerWeek                 = 7 * 24        // Nombre de créneaux horaires d'une semaine
+	firstRunMargin               = time.Minute   // Les annonces vues à moins d'une minute du premier passage en font partie
+	adaptivePriorWeight          = 0.5           // Poids ajouté à chaque créneau, pour qu'aucun ne soit jamais délaissé
+	adaptiveSearchIterations     = 50            // Itérations de la recherche du facteur d'échelle des intervalles
+	adaptiveMaxScale             = 1000 * 3600.0 // Borne haute du facteur d'échelle, en secondes
+)
+
+/**
+ * AdaptivePolling adapte l'intervalle d'une recherche aux heures de publication observées de l'agence :
+ * plus court pendant les créneaux où les nouvelles annonces apparaissent d'habitude, plus long en dehors,
+ * pour le même nombre total de requêtes qu'avec l'intervalle fixe.
+ * @property {Duration} MinInterval - Intervalle minimal, pendant les créneaux les plus actifs.
+ * @property {Duration} MaxInterval - Intervalle maximal, pendant les créneaux sans publication.
+ * @property {int} LookbackWeeks - Semaines d'historique prises en compte (défaut : 8).
+ */
+type AdaptivePolling struct {
+	MinInterval   Duration `json:"minInterval"`
+	MaxInterval   Duration `json:"maxInterval"`
+	LookbackWeeks int      `json:"lookbackWeeks,omitempty"`
+}
+
+/**
+ * pollingPlan est l'intervalle de passage de chaque créneau horaire de la semaine, du lundi 0h au dimanche 23h.
+ */
+type pollingPlan [hoursPerWeek]time.Duration
+
+/**
+ * Validate vérifie les bornes de l'intervalle adaptatif.
+ * @return {error} - La première erreur trouvée.
+ */
+func (adaptive AdaptivePolling) Validate() error {
+	switch {
+	case adaptive.MinInterval.Duration <= 0:
+		return fmt.Errorf("adaptive : minInterval manquant")
+	case adaptive.MaxInterval.Duration < adaptive.MinInterval.Duration:
+		return fmt.Errorf("adaptive : maxInterval (%s) inférieur à minInterval (%s)", adaptive.MaxInterval, adaptive.MinInterval)
+	case adaptive.LookbackWeeks < 0:
+		return fmt.Errorf("adaptive : lookbackWeeks négatif : %d", adaptive.LookbackWeeks)
+	}
+	return nil
+}
+
+/**
+ * hourOfWeek retourne le créneau horaire d'une date, de 0 (lundi 0h) à 167 (dimanche 23h).
+ * @param {time.Time} t - La date, dans le fuseau de la planification.
+ * @return {int} - Le créneau.
+ */
+func hourOfWeek(t time.Time) int {
+	// time.Weekday commence le dimanche
+	return (int(t.Weekday())+6)%7*24 + t.Hour()
+}
+
+/**
+ * PublicationCounts compte les nouvelles annonces d'une recherche (agence et transaction) par créneau horaire de la semaine,
+ * d'après leur date d'apparition. Les annonces trouvées au premier passage de la recherche ne sont pas des publications :
+ * elles sont ignorées. L'ajout d'une recherche de ventes ne fausse donc pas les créneaux des locations.
+ * @param {Agency} agency - L'agence.
+ * @param {TransactionType} transaction - Le type de transaction de la recherche.
+ * @param {*time.Location} location - Le fuseau horaire des créneaux.
+ * @param {time.Time} since - Date à partir de laquelle les apparitions sont comptées.
+ * @return {[hoursPerWeek]int} - Le nombre d'apparitions par créneau.
+ * @return {int} - Le nombre total d'apparitions comptées.
+ */
+func (store *Store) PublicationCounts(agency Agency, transaction TransactionType, location *time.Location, since time.Time) ([hoursPerWeek]int, int) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var firstRun time.Time
+	for _, stored := range store.announcements {
+		if stored.Agency == agency && stored.Transaction == transaction && (firstRun.IsZero() || stored.FirstSeen.Before(firstRun)) {
+			firstRun = stored.FirstSeen
+		}
+	}
+
+	var counts [hoursPerWeek]int
+	total := 0
+	for _, stored := range store.announcements {
+		if stored.Agency != agency || stored.Transaction != transaction || stored.FirstSeen.Before(since) || stored.FirstSeen.Sub(firstRun) < firstRunMargin {
+			continue
+		}
+		counts[hourOfWeek(stored.FirstSeen.In(location))]++
+		total++
+	}
+	return counts, total
+}
+
+/**
+ * newPollingPlan répartit les passages de la semaine entre les créneaux horaires. Pour un nombre de passages donné,
+ * le délai moyen de détection est minimal quand l'intervalle d'un créneau est inversement proportionnel à la racine
+ * carrée de son nombre de publications ; le facteur d'échelle est cherché pour ne pas dépasser le nombre de passages
+ * de l'intervalle fixe, une fois les intervalles ramenés dans leurs bornes.
+ * @param {[hoursPerWeek]int} counts - Le nombre d'apparitions par créneau.
+ * @param {time.Duration} base - L'intervalle fixe de la recherche.
+ * @param {AdaptivePolling} adaptive - Les bornes de l'intervalle.
+ * @return {*pollingPlan} - Les intervalles par créneau.
+ */
+func newPollingPlan(counts [hoursPerWeek]int, base time.Duration, adaptive AdaptivePolling) *pollingPlan {
+	// Lisser chaque créneau avec ses voisins : une annonce publiée à 9h05 aurait pu l'être à 8h55
+	var weights [hoursPerWeek]float64
+	for hour := range counts {
+		previous, next := counts[(hour+hoursPerWeek-1)%hoursPerWeek], counts[(hour+1)%hoursPerWeek]
+		weights[hour] = math.Sqrt(float64(counts[hour]) + float64(previous+next)/2 + adaptivePriorWeight)
+	}
+
+	minSeconds, maxSeconds := adaptive.MinInterval.Seconds(), adaptive.MaxInterval.Seconds()
+	budget := float64(hoursPerWeek) * 3600 / base.Seconds()
+	intervalAt := func(scale float64, hour int) float64 {
+		return math.Min(math.Max(scale/weights[hour], minSeconds), maxSeconds)
+	}
+	polls := func(scale float64) float64 {
+		total := 0.0
+		for hour := range weights {
+			total += 3600 / intervalAt(scale, hour)
+		}
+		return total
+	}
+
+	// Plus le facteur est grand, plus les intervalles sont longs : recherche dichotomique du plus petit facteur dans le budget
+	low, high := 0.0, adaptiveMaxScale
+	for i := 0; i < adaptiveSearchIterations; i++ {
+		middle := (low + high) / 2
+		if polls(middle) > budget {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+
+	plan := &pollingPlan{}
+	for hour := range plan {
+		plan[hour] = time.Duration(intervalAt(high, hour) * float64(time.Second)).Round(time.Second)
+	}
+	return plan
+}
+
+/**
+ * wait retourne l'attente avant le prochain passage. Si un créneau plus actif commence avant la fin de l'attente,
+ * le passage est avancé à ce créneau.
+ * @param {time.Time} after - La fin du passage, dans le fuseau de la planification.
+ * @return {time.Duration} - L'attente.
+ */
+func (plan *pollingPlan) wait(after time.Time) time.Duration {
+	wait := plan[hourOfWeek(after)]
+	boundary := time.Date(after.Year(), after.Month(), after.Day(), after.Hour()+1, 0, 0, 0, after.Location())
+	for ; boundary.Before(after.Add(wait)); boundary = boundary.Add(time.Hour) {
+		if candidate := max(boundary.Sub(after), plan[hourOfWeek(boundary)]); candidate < wait {
+			wait = candidate
+		}
+	}
+	return wait
+}
+
+/**
+ * bounds retourne les intervalles extrêmes du plan, pour les logs.
+ * @return {time.Duration} - L'intervalle le plus court.
+ * @return {time.Duration} - L'intervalle le plus long.
+ */
+func (plan *pollingPlan) bounds() (time.Duration, time.Duration) {
+	shortest, longest := plan[0], plan[0]
+	for _, interval := range plan {
+		shortest, longest = min(shortest, interval), max(longest, interval)
+	}
+	return shortest, longest
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"net/url"
+	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/gocolly/colly/v2"
 )
@@ -33,6 +38,84 @@ const (
 	Cogir                  Agency = "Cogir"
 )
 
+/**
+ * AllAgencies liste toutes les agences supportées par le scraper.
+ */
+var AllAgencies = []Agency{
+	Afedim,
+	Giboire,
+	Foncia,
+	AgenceDuColombier,
+	LaFrancaiseImmobiliere,
+	Guenno,
+	LaMotte,
+	Kermarrec,
+	Nestenn,
+	SquareHabitat,
+	CAImmobilier,
+	PigeaultImmobilier,
+	LaForetImmobilier,
+	Cogir,
+}
+
+// Remplacement des caractères accentués pour construire les slugs des agences
+var slugReplacer = strings.NewReplacer(
+	"à", "a", "â", "a", "ä", "a",
+	"ç", "c",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"î", "i", "ï", "i",
+	"ô", "o", "ö", "o",
+	"ù", "u", "û", "u", "ü", "u",
+	" ", "-", "'", "-",
+)
+
+/**
+ * Slug retourne le nom de l'agence utilisable dans une URL (ex: "la-francaise-immobiliere").
+ * @return {string} - Le slug de l'agence.
+ */
+func (agency Agency) Slug() string {
+	return slugReplacer.Replace(strings.ToLower(string(agency)))
+}
+
+/**
+ * findAgency retrouve une agence à partir de son nom ou de son slug, sans tenir compte de la casse.
+ * @param {string} name - Le nom ou le slug de l'agence.
+ * @return {Agency} - L'agence trouvée.
+ * @return {bool} - Faux si aucune agence ne correspond.
+ */
+func findAgency(name string) (Agency, bool) {
+	for _, agency := range AllAgencies {
+		if strings.EqualFold(string(agency), name) || agency.Slug() == strings.ToLower(name) {
+			return agency, true
+		}
+	}
+	return "", false
+}
+
+/**
+ * siteAdapter est un adaptateur réutilisable pour une plateforme de sites d'agences (plugin ou thème WordPress...).
+ */
+type siteAdapter interface {
+	setupMainPage(collector *colly.Collector, detailPageURLs *[]string)
+	processDetailPages(collector *colly.Collector, announcements *[]Announcement)
+}
+
+/**
+ * findSiteAdapter retourne l'adaptateur de plateforme d'une agence.
+ * @param {Agency} agency - L'agence.
+ * @return {siteAdapter} - L'adaptateur.
+ * @return {bool} - Faux si l'agence a un scraper spécifique.
+ */
+func findSiteAdapter(agency Agency) (siteAdapter, bool) {
+	if adapter, exists := wiaAdapters[agency]; exists {
+		return adapter, true
+	}
+	if adapter, exists := wpEstateAdapters[agency]; exists {
+		return adapter, true
+	}
+	return nil, false
+}
+
 /**
  * setupMainPageAfedim configure le collecteur pour la page principale de l'agence Afedim.
  * @param {colly.Collector} collector - Le collecteur à configurer.
@@ -62,11 +145,9 @@ func processDetailPagesAfedim(collector *colly.Collector, announcements *[]Annou
 	collector.OnHTML("span[class*='note']", func(detail *colly.HTMLElement) {
 		fullValue := detail.Text
 
-		var reference string
-		fmt.Sscanf(fullValue, "Référence du bien : %s", &reference)
-
-		if reference != "" {
-			url := detail.Request.URL.String()
+		// Les autres notes de la page ne sont pas des références
+		if reference, ok := extractReference(Afedim, fullValue); ok {
+			url := requestURL(detail.Request)
 			*announcements = append(*announcements, Announcement{
 				propertyReference: reference,
 				url:               url,
@@ -115,19 +196,16 @@ func processDetailPagesGiboire(collector *colly.Collector, announcements *[]Anno
 		// Récupérer le texte brut dans la balise
 		fullValue := detail.Text
 
-		// Nettoyer le texte pour extraire uniquement la référence
-		var reference string
-		if _, err := fmt.Sscanf(fullValue, "Réf : %s", &reference); err == nil {
-			if reference != "" {
-				// URL de la page actuelle
-				url := detail.Request.URL.String()
-
-				// Ajouter l'annonce à la liste
-				*announcements = append(*announcements, Announcement{
-					propertyReference: reference,
-					url:               url,
-				})
-			}
+		// Nettoyer le texte pour extraire uniquement la référence (elle peut contenir des espaces)
+		if reference, ok := extractReference(Giboire, fullValue); ok {
+			// URL de la page actuelle
+			url := requestURL(detail.Request)
+
+			// Ajouter l'annonce à la liste
+			*announcements = append(*announcements, Announcement{
+				propertyReference: reference,
+				url:               url,
+			})
 		} else {
 			log.Printf("Impossible d'extraire la référence depuis : %s", fullValue)
 		}
@@ -179,129 +257,18 @@ func processDetailPagesFoncia(collector *colly.Collector, announcements *[]Annou
 		// Récupérer le texte brut dans la balise
 		fullValue := strings.TrimSpace(detail.Text) // Nettoyage de la chaîne
 
-		// Essayer de parser la référence
-		var reference string
-		if _, err := fmt.Sscanf(fullValue, "Réf. %s", &reference); err == nil {
-			if reference != "" {
-				// URL de la page actuelle
-				url := detail.Request.URL.String()
-
-				// Ajouter l'annonce à la liste
-				*announcements = append(*announcements, Announcement{
-					propertyReference: reference,
-					url:               url,
-				})
-			} else {
-				log.Printf("Référence vide après extraction depuis : %s", fullValue)
-			}
-		} else {
-			log.Printf("Erreur lors de l'extraction de la référence depuis : %s, erreur : %v", fullValue, err)
-		}
-	})
-}
+		// Extraire la référence (elle peut contenir des espaces)
+		if reference, ok := extractReference(Foncia, fullValue); ok {
+			// URL de la page actuelle
+			url := requestURL(detail.Request)
 
-/**
- * setupMainPageAgenceDuColombier configure le collecteur pour la page principale de l'agence Agence du Colombier.
- * @param {colly.Collector} collector - Le collecteur à configurer.
- * @param {[]string} detailPageURLs - La liste des URLs des pages de détail.
- * @return {void}
- */
-func setupMainPageAgenceDuColombier(collector *colly.Collector, detailPageURLs *[]string) {
-	collector.OnHTML("div#listing_ajax_container", func(e *colly.HTMLElement) {
-		// Compter le nombre d'annonces et extraire les URLs
-		e.ForEach("div.listing_wrapper", func(i int, annonce *colly.HTMLElement) {
-			detailURL := annonce.ChildAttr("a", "href")
-			if detailURL != "" {
-				*detailPageURLs = append(*detailPageURLs, detailURL)
-			}
-		})
-	})
-
-}
-
-/**
- * processDetailPagesAgenceDuColombier extrait les références des annonces de la page de détail de l'agence Agence du Colombier.
- * @param {colly.Collector} collector - Le collecteur à configurer.
- * @param {[]Announcement} announcements - La liste des annonces à remplir.
- * @return {void}
- */
-func processDetailPagesAgenceDuColombier(collector *colly.Collector, announcements *[]Announcement) {
-	// Cibler la div contenant les informations principales, notamment la référence
-	collector.OnHTML("div.wpestate_estate_property_design_intext_details", func(detail *colly.HTMLElement) {
-		// Trouver la balise <p> contenant "REF:"
-		detail.ForEach("p", func(_ int, el *colly.HTMLElement) {
-			// Vérifier si la balise contient "REF:"
-			if strings.Contains(el.Text, "REF:") {
-				// Extraire le texte brut et isoler la référence
-				fullText := strings.TrimSpace(el.Text)
-				var reference string
-
-				// Extraire la partie après "REF:"
-				if _, err := fmt.Sscanf(fullText, "REF: %s", &reference); err == nil {
-					if reference != "" {
-						// URL de la page actuelle
-						url := detail.Request.URL.String()
-
-						// Ajouter l'annonce à la liste des résultats
-						*announcements = append(*announcements, Announcement{
-							propertyReference: reference,
-							url:               url,
-						})
-					}
-				} else {
-					log.Printf("Impossible d'extraire la référence depuis : %s", fullText)
-				}
-			}
-		})
-	})
-}
-
-/**
- * setupMainPageLaFrancaiseImmobiliere configure le collecteur pour la page principale de l'agence La Française Immobilière.
- * @param {colly.Collector} collector - Le collecteur à configurer.
- * @param {[]string} detailPageURLs - La liste des URLs des pages de détail.
- * @return {void}
- */
-func setupMainPageLaFrancaiseImmobiliere(collector *colly.Collector, detailPageURLs *[]string) {
-	collector.OnHTML("div#liste_annonces div.row > article", func(e *colly.HTMLElement) {
-		// Tente de récupérer l'attribut href du premier <a> dans chaque article
-		detailLink := e.ChildAttr("a[rel='bookmark']", "href")
-		if detailLink != "" {
-			*detailPageURLs = append(*detailPageURLs, detailLink)
-		} else {
-			log.Println("Lien de détail introuvable dans cet article.")
-		}
-	})
-}
-
-/**
- * processDetailPagesLaFrancaiseImmobiliere extrait les références des annonces de la page de détail de l'agence La Française Immobilière.
- * @param {colly.Collector} collector - Le collecteur à configurer.
- * @param {[]Announcement} announcements - La liste des annonces à remplir.
- * @return {void}
- */
-func processDetailPagesLaFrancaiseImmobiliere(collector *colly.Collector, announcements *[]Announcement) {
-	collector.OnHTML("p.ref.d-inline", func(detail *colly.HTMLElement) {
-		// Récupérer le texte brut dans la balise
-		fullValue := strings.TrimSpace(detail.Text) // Nettoyage de la chaîne
-
-		// Essayer de parser la référence
-		var reference string
-		if _, err := fmt.Sscanf(fullValue, "Réf : %s", &reference); err == nil {
-			if reference != "" {
-				// URL de la page actuelle
-				url := detail.Request.URL.String()
-
-				// Ajouter l'annonce à la liste
-				*announcements = append(*announcements, Announcement{
-					propertyReference: reference,
-					url:               url,
-				})
-			} else {
-				log.Printf("Référence vide après extraction depuis : %s", fullValue)
-			}
+			// Ajouter l'annonce à la liste
+			*announcements = append(*announcements, Announcement{
+				propertyReference: reference,
+				url:               url,
+			})
 		} else {
-			log.Printf("Erreur lors de l'extraction de la référence depuis : %s, erreur : %v", fullValue, err)
+			log.Printf("Référence vide après extraction depuis : %s", fullValue)
 		}
 	})
 }
@@ -338,26 +305,14 @@ func setupMainPageGuenno(collector *colly.Collector, detailPageURLs *[]string) {
  */
 func processDetailPagesGuenno(collector *colly.Collector, announcements *[]Announcement) {
 	collector.OnHTML("div#realty_area.realty_details", func(detail *colly.HTMLElement) {
-		// Rechercher l'élément contenant la référence dans l'attribut itemprop et span.grey-ref
+		// Rechercher l'élément contenant la référence ("Ref : ...") dans span.grey-ref
 		fullValue := detail.ChildText("span.grey-ref")
-		fullValue = strings.TrimSpace(fullValue)
-
-		// Vérification et extraction de la référence
-		if strings.HasPrefix(fullValue, "Ref :") {
-			// Extraire uniquement la partie après "Ref :"
-			reference := strings.TrimSpace(strings.TrimPrefix(fullValue, "Ref :"))
-			if reference != "" {
-				// URL de la page actuelle
-				url := detail.Request.URL.String()
-
-				// Ajouter l'annonce à la liste
-				*announcements = append(*announcements, Announcement{
-					propertyReference: reference,
-					url:               url,
-				})
-			} else {
-				log.Printf("Référence vide après extraction depuis : %s", fullValue)
-			}
+
+		if reference, ok := extractReference(Guenno, fullValue); ok {
+			*announcements = append(*announcements, Announcement{
+				propertyReference: reference,
+				url:               requestURL(detail.Request),
+			})
 		} else {
 			log.Printf("Impossible de trouver la référence dans : %s", fullValue)
 		}
@@ -399,26 +354,14 @@ func setupMainPageLaMotte(collector *colly.Collector, detailPageURLs *[]string)
  */
 func processDetailPagesLaMotte(collector *colly.Collector, announcements *[]Announcement) {
 	collector.OnHTML("div.heading__delivery", func(detail *colly.HTMLElement) {
-		// Récupérer le texte de la balise <p class="tva">
+		// Récupérer le texte de la balise <p class="tva"> ("Lot ..."), lu par la règle de La Motte
 		fullValue := detail.ChildText("p.tva")
-		fullValue = strings.TrimSpace(fullValue)
-
-		// Vérifier si la valeur commence par "Lot"
-		if strings.HasPrefix(fullValue, "Lot") {
-			// Extraire la partie après "Lot"
-			lot := strings.TrimSpace(strings.TrimPrefix(fullValue, "Lot"))
-			if lot != "" {
-				// URL de la page actuelle
-				url := detail.Request.URL.String()
-
-				// Ajouter l'annonce à la liste
-				*announcements = append(*announcements, Announcement{
-					propertyReference: lot,
-					url:               url,
-				})
-			} else {
-				log.Printf("Lot vide après extraction depuis : %s", fullValue)
-			}
+
+		if reference, ok := extractReference(LaMotte, fullValue); ok {
+			*announcements = append(*announcements, Announcement{
+				propertyReference: reference,
+				url:               requestURL(detail.Request),
+			})
 		} else {
 			log.Printf("Impossible de trouver le lot dans : %s", fullValue)
 		}
@@ -458,26 +401,14 @@ func setupMainPageKermarrec(collector *colly.Collector, detailPageURLs *[]string
 func processDetailPagesKermarrec(collector *colly.Collector, announcements *[]Announcement) {
 	// Cibler l'en-tête contenant la référence
 	collector.OnHTML("header.container.entry-header", func(detail *colly.HTMLElement) {
-		// Récupérer le texte contenant le ref dans la balise span.ref
+		// Récupérer le texte contenant la référence ("(ref : ...)") dans la balise span.ref
 		fullValue := detail.ChildText("span.ref")
-		fullValue = strings.TrimSpace(fullValue)
-
-		// Vérification et extraction de la référence
-		if strings.HasPrefix(fullValue, "(ref :") {
-			// Extraire uniquement la partie après "(ref :" et enlever la parenthèse fermante
-			reference := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(fullValue, "(ref :"), ")"))
-			if reference != "" {
-				// URL de la page actuelle
-				url := detail.Request.URL.String()
-
-				// Ajouter l'annonce à la liste
-				*announcements = append(*announcements, Announcement{
-					propertyReference: reference,
-					url:               url,
-				})
-			} else {
-				log.Printf("Référence vide après extraction depuis : %s", fullValue)
-			}
+
+		if reference, ok := extractReference(Kermarrec, fullValue); ok {
+			*announcements = append(*announcements, Announcement{
+				propertyReference: reference,
+				url:               requestURL(detail.Request),
+			})
 		} else {
 			log.Printf("Impossible de trouver la référence dans : %s", fullValue)
 		}
@@ -517,32 +448,14 @@ func setupMainPageNestenn(collector *colly.Collector, detailPageURLs *[]string)
 func processDetailPagesNestenn(collector *colly.Collector, announcements *[]Announcement) {
 	// Cibler la div contenant la référence
 	collector.OnHTML("div.property_ref", func(detail *colly.HTMLElement) {
-		// Récupérer le texte brut dans la div
-		fullValue := strings.TrimSpace(detail.Text)
-
-		// Rechercher et extraire la référence après "Réf :"
-		if strings.Contains(fullValue, "Réf :") {
-			// Diviser la chaîne sur "Réf :" et récupérer la partie après
-			parts := strings.Split(fullValue, "Réf :")
-			if len(parts) > 1 {
-				reference := strings.TrimSpace(parts[1])
-
-				// Vérifier si la référence est non vide
-				if reference != "" {
-					// URL de la page actuelle
-					url := detail.Request.URL.String()
-
-					// Ajouter l'annonce à la liste
-					*announcements = append(*announcements, Announcement{
-						propertyReference: reference,
-						url:               url,
-					})
-				} else {
-					log.Printf("Référence vide après extraction depuis : %s", fullValue)
-				}
-			} else {
-				log.Printf("Impossible de diviser la chaîne pour trouver la référence : %s", fullValue)
-			}
+		// Récupérer le texte brut de la div, lu par la règle de Nestenn (référence après "Réf :")
+		fullValue := detail.Text
+
+		if reference, ok := extractReference(Nestenn, fullValue); ok {
+			*announcements = append(*announcements, Announcement{
+				propertyReference: reference,
+				url:               requestURL(detail.Request),
+			})
 		} else {
 			log.Printf("Pas de 'Réf :' trouvé dans : %s", fullValue)
 		}
@@ -551,27 +464,132 @@ func processDetailPagesNestenn(collector *colly.Collector, announcements *[]Anno
 
 /**
  * setupMainPageSquareHabitat configure le collecteur pour la page principale de Square Habitat.
+ * Les cartes sans lien vers une page de détails sont ajoutées directement, avec une empreinte de leur contenu comme référence.
  * @param {colly.Collector} collector - Le collecteur à configurer.
  * @param {[]string} detailPageURLs - La liste des URLs des pages de détail.
+ * @param {[]Announcement} cardAnnouncements - La liste des annonces sans page de détails.
  * @return {void}
  */
-func setupMainPageSquareHabitat(collector *colly.Collector, details *[]string) {
+func setupMainPageSquareHabitat(collector *colly.Collector, detailPageURLs *[]string, cardAnnouncements *[]Announcement) {
+	// Utiliser un ensemble pour éviter les doublons
+	seenURLs := make(map[string]struct{})
+
 	// Cibler la div principale contenant les annonces
 	collector.OnHTML("div.biens-container.afc-display-xs-flex.afc-width-xs-100", func(e *colly.HTMLElement) {
 		// Parcourir chaque carte (card-container)
 		e.ForEach("div.card-container", func(index int, property *colly.HTMLElement) {
-			description := property.ChildText("app-card-bien > msl-card > div:nth-of-type(2) > div:nth-of-type(4) > app-texte-on-off > div.container > div.text-container > p")
+			// Le lien de la carte mène à la page de détails, qui porte la référence de l'agence
+			if href := property.ChildAttr("a[href]", "href"); href != "" {
+				fullURL := property.Request.AbsoluteURL(href)
+				if _, exists := seenURLs[fullURL]; !exists {
+					seenURLs[fullURL] = struct{}{}
+					*detailPageURLs = append(*detailPageURLs, fullURL)
+				}
+				return
+			}
 
-			// Vérifier si une description est trouvée
-			if description == "" {
-				log.Printf("Aucune description trouvée pour l'annonce %d", index+1)
-			} else {
-				*details = append(*details, description)
+			// Sans page de détails, le lien du message mène à la page de résultats où figure la carte
+			text := strings.Join(strings.Fields(property.Text), " ")
+			announcement := Announcement{
+				url:     requestURL(property.Request),
+				price:   firstPrice(text),
+				surface: firstSurface(text),
+				rooms:   firstRooms(text),
+				city:    firstCity(text),
+			}
+			if photo := property.ChildAttr("img[src]", "src"); photo != "" {
+				announcement.photo = property.Request.AbsoluteURL(photo)
 			}
+
+			announcement.propertyReference = contentFingerprint(announcement)
+			if announcement.propertyReference == "" {
+				log.Printf("Annonce %d ignorée : ni lien ni caractéristiques pour l'identifier", index+1)
+				return
+			}
+			*cardAnnouncements = append(*cardAnnouncements, announcement)
 		})
 	})
 }
 
+/**
+ * processDetailPagesSquareHabitat extrait les références des annonces de la page de détail de Square Habitat.
+ * La référence de l'agence est cherchée dans le contenu propre à l'annonce (sans menus, pied de page ni annonces similaires),
+ * l'identifiant de l'URL sert de repli, puis une empreinte des caractéristiques du bien.
+ * @param {colly.Collector} collector - Le collecteur à configurer.
+ * @param {[]Announcement} announcements - La liste des annonces à remplir.
+ * @return {void}
+ */
+func processDetailPagesSquareHabitat(collector *colly.Collector, announcements *[]Announcement) {
+	collector.OnHTML("body", func(detail *colly.HTMLElement) {
+		// URL de la page actuelle
+		url := requestURL(detail.Request)
+
+		// Les annonces similaires et le pied de page portent d'autres références : seul le contenu de l'annonce est lu
+		content := detail.DOM.Clone()
+		content.Find(nonListingContainers).Remove()
+		text := strings.Join(strings.Fields(content.Text()), " ")
+
+		if match := squareHabitatReferencePattern.FindStringSubmatch(text); match != nil {
+			*announcements = append(*announcements, Announcement{
+				propertyReference: match[1],
+				url:               url,
+			})
+			return
+		}
+
+		// L'identifiant de l'URL ne change pas avec le titre ni avec les annonces similaires affichées sur la page
+		if reference := referenceFromURL(url); reference != "" {
+			log.Printf("Aucune référence trouvée sur la page %s, utilisation de l'identifiant de l'URL", url)
+			*announcements = append(*announcements, Announcement{propertyReference: reference, url: url})
+			return
+		}
+
+		announcement := Announcement{
+			url:     url,
+			surface: firstSurface(text),
+			rooms:   firstRooms(text),
+			city:    firstCity(text),
+			photo:   detail.ChildAttr("meta[property='og:image']", "content"),
+		}
+		announcement.propertyReference = contentFingerprint(announcement)
+		if announcement.propertyReference == "" {
+			log.Printf("Aucune référence trouvée sur la page %s, annonce ignorée", url)
+			return
+		}
+		log.Printf("Aucune référence trouvée sur la page %s, utilisation d'une empreinte des caractéristiques", url)
+		*announcements = append(*announcements, announcement)
+	})
+}
+
+// Expression régulière pour trouver la référence de l'agence sur une page de détails Square Habitat
+var squareHabitatReferencePattern = regexp.MustCompile(`(?i:R[ée]f(?:[ée]rence)?(?:\s+(?:du\s+)?(?:bien|annonce|mandat))?)\s*[.:]?\s*:?\s*([A-Z0-9][A-Z0-9/_-]{3,})`)
+
+/**
+ * contentFingerprint calcule une référence stable pour une annonce sans référence d'agence.
+ * L'empreinte porte sur les caractéristiques structurées du bien (surface, pièces, ville, photo) et non sur le texte libre :
+ * corriger le titre ou la description ne crée pas de nouvelle annonce, et deux biens au même titre restent distincts.
+ * Le prix est exclu pour qu'une baisse de prix reste la même annonce.
+ * @param {Announcement} announcement - Les caractéristiques de l'annonce.
+ * @return {string} - La référence, préfixée par "fp-", vide si aucune caractéristique n'est connue.
+ */
+func contentFingerprint(announcement Announcement) string {
+	// Les paramètres de l'URL de la photo (taille, version) changent sans que la photo change
+	photo := announcement.photo
+	if parsed, err := url.Parse(photo); err == nil {
+		photo = parsed.Host + parsed.Path
+	}
+	city := strings.Join(strings.FieldsFunc(slugReplacer.Replace(strings.ToLower(announcement.city)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+	if announcement.surface == 0 && announcement.rooms == 0 && city == "" && photo == "" {
+		return ""
+	}
+
+	content := fmt.Sprintf("%g|%d|%s|%s", announcement.surface, announcement.rooms, city, photo)
+	sum := sha256.Sum256([]byte(content))
+	return "fp-" + hex.EncodeToString(sum[:8])
+}
+
 /**
  * setupMainPageCAImmobilier configure le collecteur pour la page principale de CA Immobilier.
  * @param {colly.Collector} collector - Le collecteur à configurer.
@@ -605,57 +623,6 @@ func setupMainPageCAImmobilier(collector *colly.Collector, detailPageURLs *[]str
  * @param {[]Announcement} announcements - La liste des annonces à remplir.
  * @return {void}
  */
-func setupMainPagePigeaultImmobilier(collector *colly.Collector, detailPageURLs *[]string) {
-	// Cibler la div contenant toutes les annonces
-	collector.OnHTML("div#liste_annonces", func(e *colly.HTMLElement) {
-		// Parcourir chaque <article> dans la div "row"
-		e.ForEach("div.row article", func(_ int, article *colly.HTMLElement) {
-			// Accéder à la balise <a> avec le href pour l'URL de l'annonce
-			href := article.ChildAttr("a[rel='bookmark']", "href")
-			if href != "" {
-				*detailPageURLs = append(*detailPageURLs, href)
-			} else {
-				log.Println("Aucun href trouvé pour cet article")
-			}
-		})
-	})
-}
-
-/**
- * processDetailPagesPigeaultImmobilier extrait les références des annonces de la page de détail de Pigeault Immobilier.
- * @param {colly.Collector} collector - Le collecteur à configurer.
- * @param {[]Announcement} announcements - La liste des annonces à remplir.
- * @return {void}
- */
-func processDetailPagesPigeaultImmobilier(collector *colly.Collector, announcements *[]Announcement) {
-	// Cibler la div contenant les informations principales
-	collector.OnHTML("div#top_infos", func(detail *colly.HTMLElement) {
-		// Récupérer la référence dans la balise <p> avec la classe "ref"
-		fullValue := detail.ChildText("p.ref")
-		fullValue = strings.TrimSpace(fullValue)
-
-		// Vérification et extraction de la référence
-		if strings.HasPrefix(fullValue, "Réf :") {
-			// Extraire uniquement la partie après "Réf :"
-			reference := strings.TrimSpace(strings.TrimPrefix(fullValue, "Réf :"))
-			if reference != "" {
-				// URL de la page actuelle
-				url := detail.Request.URL.String()
-
-				// Ajouter l'annonce à la liste
-				*announcements = append(*announcements, Announcement{
-					propertyReference: reference,
-					url:               url,
-				})
-			} else {
-				log.Printf("Référence vide après extraction depuis : %s", fullValue)
-			}
-		} else {
-			log.Printf("Impossible de trouver la référence dans : %s", fullValue)
-		}
-	})
-}
-
 func setupMainPageLaForetImmobilier(collector *colly.Collector, detailPageURLs *[]string) {
 	// Cibler la div principale contenant les annonces
 	collector.OnHTML("div.properties__list", func(e *colly.HTMLElement) {
@@ -678,23 +645,14 @@ func setupMainPageLaForetImmobilier(collector *colly.Collector, detailPageURLs *
 func processDetailPagesLaForetImmobilier(collector *colly.Collector, announcements *[]Announcement) {
 	// Cibler la section contenant les informations de l'annonce
 	collector.OnHTML("section.property__block.property-content", func(detail *colly.HTMLElement) {
-		// Récupérer la référence web
+		// Récupérer la référence web et la référence agence, départagées par la règle de La Foret
 		webRef := detail.ChildText("h5.text-base.text-ref:contains('Référence web')")
-		webRef = strings.TrimSpace(strings.TrimPrefix(webRef, "Référence web :"))
-
-		// Récupérer la référence agence
 		agencyRef := detail.ChildText("h5.text-base.text-ref:contains('Référence Agence')")
-		agencyRef = strings.TrimSpace(strings.TrimPrefix(agencyRef, "Référence Agence :"))
-
-		// Vérifier si des références valides sont trouvées
-		if webRef != "" || agencyRef != "" {
-			// URL actuelle de la page
-			url := detail.Request.URL.String()
 
-			// Ajouter l'annonce avec les références à la liste
+		if reference, ok := extractReference(LaForetImmobilier, webRef+", "+agencyRef); ok {
 			*announcements = append(*announcements, Announcement{
-				propertyReference: fmt.Sprintf("Web: %s, Agence: %s", webRef, agencyRef),
-				url:               url,
+				propertyReference: reference,
+				url:               requestURL(detail.Request),
 			})
 		} else {
 			log.Println("Aucune référence trouvée dans cette annonce")
@@ -720,19 +678,13 @@ func setupMainPageCogir(collector *colly.Collector, announcementURLs *[]string)
 func processDetailPagesCogir(collector *colly.Collector, announcements *[]Announcement) {
 	// Cibler la section contenant les informations de l'annonce
 	collector.OnHTML("div.detail_header", func(detail *colly.HTMLElement) {
-		// Récupérer la référence de l'annonce
-		ref := detail.ChildText("div.crit span:contains('Réf.')")
-		ref = strings.TrimSpace(strings.TrimPrefix(ref, "Réf."))
-
-		// Vérifier si une référence valide est trouvée
-		if ref != "" {
-			// URL actuelle de la page
-			url := detail.Request.URL.String()
+		// Récupérer la référence de l'annonce ("Réf. ...")
+		fullValue := detail.ChildText("div.crit span:contains('Réf.')")
 
-			// Ajouter l'annonce avec la référence à la liste
+		if reference, ok := extractReference(Cogir, fullValue); ok {
 			*announcements = append(*announcements, Announcement{
-				propertyReference: ref,
-				url:               url,
+				propertyReference: reference,
+				url:               requestURL(detail.Request),
 			})
 		}
 	})
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Valeurs par défaut et maximale du nombre d'annonces par page de l'API
+const (
+	DefaultPerPage = 50
+	MaxPerPage     = 500
+)
+
+/**
+ * APIServer expose les annonces stockées et la santé des agences en HTTP.
+ * @property {*Store} store - Le store des annonces.
+ * @property {*LiveConfig} config - La configuration courante (profils de recherche).
+ * @property {*ScraperControl} control - Le contrôle du scraper (pauses, relances) utilisé par le dashboard.
+ * @property {*ProxyPool} proxies - Le pool de proxies, nil si aucun proxy n'est configuré.
+ * @property {*CircuitBreakers} breakers - Les disjoncteurs des agences.
+ */
+type APIServer struct {
+	store    *Store
+	config   *LiveConfig
+	control  *ScraperControl
+	proxies  *ProxyPool
+	breakers *CircuitBreakers
+}
+
+/**
+ * announcementsPage est la réponse paginée de GET /announcements.
+ */
+type announcementsPage struct {
+	Total   int                  `json:"total"`
+	Page    int                  `json:"page"`
+	PerPage int                  `json:"per_page"`
+	Items   []StoredAnnouncement `json:"items"`
+}
+
+/**
+ * NewAPIServer crée le serveur HTTP de l'API.
+ * @param {*Store} store - Le store des annonces.
+ * @param {*LiveConfig} config - La configuration courante (profils de recherche).
+ * @param {*ScraperControl} control - Le contrôle du scraper (pauses, relances).
+ * @param {*ProxyPool} proxies - Le pool de proxies, nil si aucun proxy n'est configuré.
+ * @param {*CircuitBreakers} breakers - Les disjoncteurs des agences.
+ * @return {*APIServer} - Le serveur de l'API.
+ */
+func NewAPIServer(store *Store, config *LiveConfig, control *ScraperControl, proxies *ProxyPool, breakers *CircuitBreakers) *APIServer {
+	return &APIServer{store: store, config: config, control: control, proxies: proxies, breakers: breakers}
+}
+
+/**
+ * Handler retourne le routeur HTTP de l'API.
+ * @return {http.Handler} - Le routeur.
+ */
+func (api *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	api.registerRoutes(mux)
+	return mux
+}
+
+/**
+ * registerRoutes enregistre les routes de l'API sur le routeur.
+ * @param {*http.ServeMux} mux - Le routeur.
+ * @return {void}
+ */
+func (api *APIServer) registerRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /announcements", api.handleListAnnouncements)
+	mux.HandleFunc("GET /announcements.geojson", api.handleGeoJSON)
+	mux.HandleFunc("GET /announcements/{agency}/{reference...}", api.handleGetAnnouncement)
+	mux.HandleFunc("GET /agencies", api.handleListAgencies)
+	mux.HandleFunc("GET /proxies", api.handleListProxies)
+	mux.HandleFunc("GET /circuits", api.handleListCircuits)
+	mux.HandleFunc("GET /export", api.handleExport)
+	mux.HandleFunc("GET /feeds/all.atom", api.handleAllFeed)
+	mux.HandleFunc("GET /feeds/agency/{file}", api.handleAgencyFeed)
+	mux.HandleFunc("GET /feeds/profile/{file}", api.handleProfileFeed)
+	api.registerDashboardRoutes(mux)
+}
+
+/**
+ * Start lance le serveur HTTP en arrière-plan.
+ * @param {string} addr - L'adresse d'écoute (ex: ":8080").
+ * @return {void}
+ */
+func (api *APIServer) Start(addr string) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           api.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Printf("API HTTP démarrée sur %s", addr)
+		if err := server.ListenAndServe(); err != nil {
+			log.Printf("Erreur du serveur HTTP de l'API : %v", err)
+		}
+	}()
+}
+
+/**
+ * handleListAnnouncements gère GET /announcements avec filtres, tri et pagination.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleListAnnouncements(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, err := parseAnnouncementFilter(query)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sortBy := query.Get("sort")
+	if !isValidSortField(sortBy) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("tri inconnu : %s", sortBy))
+		return
+	}
+
+	page, err := parsePositiveInt(query, "page", 1)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	perPage, err := parsePositiveInt(query, "per_page", DefaultPerPage)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if perPage > MaxPerPage {
+		perPage = MaxPerPage
+	}
+
+	results := api.store.Query(filter, sortBy)
+
+	// Borner la page avant la multiplication : une page démesurée ferait déborder l'index de départ
+	start := len(results)
+	if page-1 <= len(results)/perPage {
+		start = min((page-1)*perPage, len(results))
+	}
+	end := start + perPage
+	if end > len(results) {
+		end = len(results)
+	}
+
+	writeJSON(w, http.StatusOK, announcementsPage{
+		Total:   len(results),
+		Page:    page,
+		PerPage: perPage,
+		Items:   append([]StoredAnnouncement{}, results[start:end]...),
+	})
+}
+
+/**
+ * handleGetAnnouncement gère GET /announcements/{agency}/{reference} et retourne l'historique complet.
+ * Le paramètre transaction (location ou vente) distingue deux annonces de même référence.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleGetAnnouncement(w http.ResponseWriter, r *http.Request) {
+	agency := Agency(r.PathValue("agency"))
+	if found, exists := findAgency(string(agency)); exists {
+		agency = found
+	}
+	reference := r.PathValue("reference")
+
+	announcement, exists := api.store.Get(agency, TransactionType(r.URL.Query().Get("transaction")), reference)
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("annonce introuvable : %s / %s", agency, reference))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, announcement)
+}
+
+/**
+ * handleListAgencies gère GET /agencies et retourne la santé du scraping de chaque agence.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleListAgencies(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, api.store.Health())
+}
+
+/**
+ * handleListProxies gère GET /proxies et retourne les statistiques de chaque proxy du pool.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleListProxies(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, api.proxies.Metrics())
+}
+
+/**
+ * handleListCircuits gère GET /circuits et retourne l'état du disjoncteur de chaque agence.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleListCircuits(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, api.breakers.Statuses())
+}
+
+/**
+ * parseAnnouncementFilter construit le filtre des annonces depuis les paramètres de la requête.
+ * @param {url.Values} query - Les paramètres de la requête.
+ * @return {AnnouncementFilter} - Le filtre.
+ * @return {error} - Erreur si un paramètre est invalide.
+ */
+func parseAnnouncementFilter(query url.Values) (AnnouncementFilter, error) {
+	var filter AnnouncementFilter
+	var err error
+
+	for _, name := range query["agency"] {
+		agency, exists := findAgency(name)
+		if !exists {
+			return filter, fmt.Errorf("agence inconnue : %s", name)
+		}
+		filter.Agencies = append(filter.Agencies, agency)
+	}
+
+	switch status := AnnouncementStatus(query.Get("status")); status {
+	case "", StatusActive, StatusRemoved:
+		filter.Status = status
+	default:
+		return filter, fmt.Errorf("statut inconnu : %s", status)
+	}
+
+	switch transaction := TransactionType(query.Get("transaction")); transaction {
+	case "", TransactionRent, TransactionSale:
+		filter.Transaction = transaction
+	default:
+		return filter, fmt.Errorf("transaction inconnue : %s", transaction)
+	}
+
+	filter.City = query.Get("city")
+
+	if filter.MinPrice, err = parseFloatParam(query, "min_price"); err != nil {
+		return filter, err
+	}
+	if filter.MaxPrice, err = parseFloatParam(query, "max_price"); err != nil {
+		return filter, err
+	}
+	if filter.MinSurface, err = parseFloatParam(query, "min_surface"); err != nil {
+		return filter, err
+	}
+	if filter.MaxSurface, err = parseFloatParam(query, "max_surface"); err != nil {
+		return filter, err
+	}
+	if filter.FirstSeenFrom, err = parseTimeParam(query, "first_seen_from"); err != nil {
+		return filter, err
+	}
+	if filter.FirstSeenTo, err = parseTimeParam(query, "first_seen_to"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+/**
+ * parseFloatParam lit un paramètre numérique de la requête.
+ * @param {url.Values} query - Les paramètres de la requête.
+ * @param {string} name - Le nom du paramètre.
+ * @return {float64} - La valeur, 0 si absente.
+ * @return {error} - Erreur si la valeur n'est pas un nombre positif.
+ */
+func parseFloatParam(query url.Values, name string) (float64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("paramètre %s invalide : %s", name, value)
+	}
+	return number, nil
+}
+
+/**
+ * parsePositiveInt lit un paramètre entier strictement positif de la requête.
+ * @param {url.Values} query - Les paramètres de la requête.
+ * @param {string} name - Le nom du paramètre.
+ * @param {int} defaultValue - La valeur si le paramètre est absent.
+ * @return {int} - La valeur.
+ * @return {error} - Erreur si la valeur n'est pas un entier strictement positif.
+ */
+func parsePositiveInt(query url.Values, name string, defaultValue int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return 0, fmt.Errorf("paramètre %s invalide : %s", name, value)
+	}
+	return number, nil
+}
+
+/**
+ * parseTimeParam lit une date de la requête, au format RFC 3339 ou AAAA-MM-JJ.
+ * @param {url.Values} query - Les paramètres de la requête.
+ * @param {string} name - Le nom du paramètre.
+ * @return {time.Time} - La date, zéro si absente.
+ * @return {error} - Erreur si la date est invalide.
+ */
+func parseTimeParam(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	if date, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("paramètre %s invalide (attendu AAAA-MM-JJ ou RFC 3339) : %s", name, value)
+}
+
+/**
+ * writeJSON écrit une réponse JSON.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {int} status - Le code HTTP.
+ * @param {any} value - La valeur à encoder.
+ * @return {void}
+ */
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Erreur lors de l'écriture de la réponse JSON : %v", err)
+	}
+}
+
+/**
+ * writeJSONError écrit une erreur au format JSON.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {int} status - Le code HTTP.
+ * @param {string} message - Le message d'erreur.
+ * @return {void}
+ */
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+/**
+ * CircuitState est l'état du disjoncteur d'une agence.
+ */
+type CircuitState string
+
+/**
+ * Constantes pour les états du disjoncteur.
+ */
+const (
+	CircuitClosed   CircuitState = "closed"    // L'agence est scrapée normalement
+	CircuitOpen     CircuitState = "open"      // L'agence est ignorée jusqu'à la fin du temps de repos
+	CircuitHalfOpen CircuitState = "half-open" // Une seule requête de sonde est envoyée pour tester l'agence
+)
+
+// Valeurs par défaut des disjoncteurs des agences
+const (
+	DefaultBreakerErrorRate   = 0.5
+	DefaultBreakerMinRequests = 5
+	DefaultBreakerCooldown    = 5 * time.Minute
+	DefaultBreakerMaxCooldown = 2 * time.Hour
+)
+
+/**
+ * BreakerConfig est la configuration des disjoncteurs des agences.
+ * @property {float64} ErrorRate - Taux d'erreurs des requêtes d'un cycle qui ouvre le disjoncteur (défaut : 0.5).
+ * @property {int} MinRequests - Nombre de requêtes à partir duquel le taux d'erreurs est pris en compte (défaut : 5).
+ * @property {Duration} Cooldown - Temps de repos après la première ouverture, doublé à chaque sonde en échec (défaut : 5 minutes).
+ * @property {Duration} MaxCooldown - Temps de repos maximal (défaut : 2 heures).
+ */
+type BreakerConfig struct {
+	ErrorRate   float64  `json:"errorRate,omitempty"`
+	MinRequests int      `json:"minRequests,omitempty"`
+	Cooldown    Duration `json:"cooldown,omitempty"`
+	MaxCooldown Duration `json:"maxCooldown,omitempty"`
+}
+
+/**
+ * requestOutcome compte les requêtes d'un cycle et leurs échecs.
+ * @property {int} requests - Nombre de requêtes terminées (réponse ou erreur).
+ * @property {int} failures - Nombre de requêtes en erreur ou bloquées.
+ * @property {int} blocked - Nombre de réponses de blocage (403, 429, 503, page anti-bot).
+ */
+type requestOutcome struct {
+	requests int
+	failures int
+	blocked  int
+}
+
+/**
+ * CircuitStatus est l'état du disjoncteur d'une agence, exposé par l'API.
+ */
+type CircuitStatus struct {
+	Agency   Agency       `json:"agency"`
+	State    CircuitState `json:"state"`
+	Trips    int          `json:"trips"`
+	OpenedAt *time.Time   `json:"opened_at,omitempty"`
+	RetryAt  *time.Time   `json:"retry_at,omitempty"`
+	Reason   string       `json:"reason,omitempty"`
+}
+
+/**
+ * circuit est le disjoncteur d'une agence.
+ */
+type circuit struct {
+	state    CircuitState
+	trips    int
+	cooldown time.Duration
+	openedAt time.Time
+	retryAt  time.Time
+	reason   string
+	probing  bool
+}
+
+/**
+ * CircuitBreakers regroupe les disjoncteurs des agences : une agence en panne ou qui bloque le scraper
+ * est ignorée pendant un temps de repos croissant, puis testée par une seule requête avant d'être reprise.
+ * @property {sync.Mutex} mu - Verrou protégeant les disjoncteurs.
+ * @property {BreakerConfig} config - La configuration, complétée par les valeurs par défaut.
+ * @property {map[Agency]*circuit} circuits - Les disjoncteurs, créés au premier cycle de chaque agence.
+ * @property {Notifier} notifier - Le canal de notification des changements d'état (chat d'administration).
+ */
+type CircuitBreakers struct {
+	mu       sync.Mutex
+	config   BreakerConfig
+	circuits map[Agency]*circuit
+	notifier Notifier
+}
+
+/**
+ * Validate vérifie la configuration des disjoncteurs.
+ * @return {error} - La première erreur trouvée.
+ */
+func (config BreakerConfig) Validate() error {
+	switch {
+	case config.ErrorRate < 0 || config.ErrorRate > 1:
+		return fmt.Errorf("circuitBreaker : errorRate doit être compris entre 0 et 1 : %v", config.ErrorRate)
+	case config.MinRequests < 0:
+		return fmt.Errorf("circuitBreaker : minRequests négatif : %d", config.MinRequests)
+	case config.Cooldown.Duration < 0 || config.MaxCooldown.Duration < 0:
+		return fmt.Errorf("circuitBreaker : cooldown et maxCooldown ne peuvent pas être négatifs")
+	}
+	return nil
+}
+
+/**
+ * NewCircuitBreakers crée les disjoncteurs des agences.
+ * @param {*BreakerConfig} config - La configuration, valeurs par défaut si nil.
+ * @param {Notifier} notifier - Le canal de notification des changements d'état.
+ * @return {*CircuitBreakers} - Les disjoncteurs.
+ */
+func NewCircuitBreakers(config *BreakerConfig, notifier Notifier) *CircuitBreakers {
+	return &CircuitBreakers{
+		config:   resolveBreakerConfig(config),
+		circuits: make(map[Agency]*circuit),
+		notifier: notifier,
+	}
+}
+
+/**
+ * resolveBreakerConfig complète la configuration des disjoncteurs par les valeurs par défaut.
+ * @param {*BreakerConfig} config - La configuration, valeurs par défaut si nil.
+ * @return {BreakerConfig} - La configuration complète.
+ */
+func resolveBreakerConfig(config *BreakerConfig) BreakerConfig {
+	resolved := BreakerConfig{
+		ErrorRate:   DefaultBreakerErrorRate,
+		MinRequests: DefaultBreakerMinRequests,
+		Cooldown:    Duration{DefaultBreakerCooldown},
+		MaxCooldown: Duration{DefaultBreakerMaxCooldown},
+	}
+	if config != nil {
+		if config.ErrorRate > 0 {
+			resolved.ErrorRate = config.ErrorRate
+		}
+		if config.MinRequests > 0 {
+			resolved.MinRequests = config.MinRequests
+		}
+		if config.Cooldown.Duration > 0 {
+			resolved.Cooldown = config.Cooldown
+		}
+		if config.MaxCooldown.Duration > 0 {
+			resolved.MaxCooldown = config.MaxCooldown
+		}
+	}
+	if resolved.MaxCooldown.Duration < resolved.Cooldown.Duration {
+		resolved.MaxCooldown = resolved.Cooldown
+	}
+	return resolved
+}
+
+/**
+ * Configure remplace la configuration des disjoncteurs, au rechargement de la configuration.
+ * L'état des disjoncteurs est conservé : un disjoncteur ouvert le reste jusqu'à la fin de son temps de repos.
+ * @param {*BreakerConfig} config - La nouvelle configuration, valeurs par défaut si nil.
+ * @return {void}
+ */
+func (breakers *CircuitBreakers) Configure(config *BreakerConfig) {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	breakers.config = resolveBreakerConfig(config)
+}
+
+/**
+ * circuitLocked retourne le disjoncteur d'une agence, créé fermé au premier appel. Le verrou doit être détenu.
+ * @param {Agency} agency - L'agence.
+ * @return {*circuit} - Le disjoncteur.
+ */
+func (breakers *CircuitBreakers) circuitLocked(agency Agency) *circuit {
+	state, exists := breakers.circuits[agency]
+	if !exists {
+		state = &circuit{state: CircuitClosed}
+		breakers.circuits[agency] = state
+	}
+	return state
+}
+
+/**
+ * Allow indique si l'agence peut être scrapée. À la fin du temps de repos, le disjoncteur passe en demi-ouvert
+ * et le cycle se limite à une requête de sonde. Une seule sonde est en cours à la fois : les autres recherches
+ * de l'agence attendent son résultat.
+ * @param {Agency} agency - L'agence.
+ * @param {time.Time} now - La date du cycle.
+ * @return {bool} - Vrai si l'agence peut être scrapée.
+ * @return {bool} - Vrai si le cycle est une sonde.
+ */
+func (breakers *CircuitBreakers) Allow(agency Agency, now time.Time) (bool, bool) {
+	breakers.mu.Lock()
+	state := breakers.circuitLocked(agency)
+	switch {
+	case state.state == CircuitClosed:
+		breakers.mu.Unlock()
+		return true, false
+	case state.state == CircuitHalfOpen && state.probing:
+		breakers.mu.Unlock()
+		return false, false
+	case state.state == CircuitHalfOpen:
+		state.probing = true
+		breakers.mu.Unlock()
+		return true, true
+	case now.Before(state.retryAt):
+		breakers.mu.Unlock()
+		return false, false
+	}
+	state.state = CircuitHalfOpen
+	state.probing = true
+	breakers.mu.Unlock()
+
+	breakers.notify(fmt.Sprintf("🟡 Disjoncteur de l'agence %s demi-ouvert : envoi d'une requête de sonde", agency))
+	return true, true
+}
+
+/**
+ * RetryAt retourne la date de la prochaine sonde d'une agence dont le disjoncteur est ouvert.
+ * @param {Agency} agency - L'agence.
+ * @return {time.Time} - La date de la prochaine sonde.
+ */
+func (breakers *CircuitBreakers) RetryAt(agency Agency) time.Time {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	return breakers.circuitLocked(agency).retryAt
+}
+
+/**
+ * Trips indique si les requêtes d'un cycle doivent ouvrir le disjoncteur : une réponse de blocage,
+ * ou un taux d'erreurs trop élevé. Pendant une sonde, le moindre échec suffit.
+ * @param {requestOutcome} outcome - Les requêtes du cycle.
+ * @param {bool} probe - Vrai si le cycle est une sonde.
+ * @return {bool} - Vrai si le disjoncteur doit s'ouvrir.
+ */
+func (breakers *CircuitBreakers) Trips(outcome requestOutcome, probe bool) bool {
+	if outcome.blocked > 0 || (probe && outcome.failures > 0) {
+		return true
+	}
+	breakers.mu.Lock()
+	config := breakers.config
+	breakers.mu.Unlock()
+
+	return outcome.requests >= config.MinRequests &&
+		float64(outcome.failures)/float64(outcome.requests) >= config.ErrorRate
+}
+
+/**
+ * Record met à jour le disjoncteur d'une agence avec les requêtes du cycle et notifie les changements d'état.
+ * @param {Agency} agency - L'agence.
+ * @param {requestOutcome} outcome - Les requêtes du cycle.
+ * @param {bool} probe - Vrai si le cycle était une sonde.
+ * @param {time.Time} now - La date du cycle.
+ * @return {void}
+ */
+func (breakers *CircuitBreakers) Record(agency Agency, outcome requestOutcome, probe bool, now time.Time) {
+	tripped := breakers.Trips(outcome, probe)
+
+	breakers.mu.Lock()
+	state := breakers.circuitLocked(agency)
+	if probe {
+		state.probing = false
+	}
+	var message string
+	switch {
+	case tripped && state.state == CircuitHalfOpen:
+		// Sonde en échec : le temps de repos double, jusqu'au maximum
+		state.cooldown = min(state.cooldown*2, breakers.config.MaxCooldown.Duration)
+		breakers.openLocked(state, outcome, now)
+		message = fmt.Sprintf("🔴 Sonde en échec pour l'agence %s (%s) : disjoncteur rouvert pour %s", agency, state.reason, state.cooldown)
+	case tripped && state.state == CircuitClosed:
+		state.cooldown = breakers.config.Cooldown.Duration
+		breakers.openLocked(state, outcome, now)
+		message = fmt.Sprintf("🔴 Disjoncteur de l'agence %s ouvert (%s) : agence ignorée pendant %s", agency, state.reason, state.cooldown)
+	case !tripped && state.state == CircuitHalfOpen:
+		*state = circuit{state: CircuitClosed, trips: state.trips}
+		message = fmt.Sprintf("🟢 Disjoncteur de l'agence %s refermé : la sonde a réussi, reprise du scraping", agency)
+	}
+	breakers.mu.Unlock()
+
+	if message != "" {
+		breakers.notify(message)
+	}
+}
+
+/**
+ * openLocked ouvre un disjoncteur pour son temps de repos. Le verrou doit être détenu.
+ * @param {*circuit} state - Le disjoncteur.
+ * @param {requestOutcome} outcome - Les requêtes du cycle qui a ouvert le disjoncteur.
+ * @param {time.Time} now - La date du cycle.
+ * @return {void}
+ */
+func (breakers *CircuitBreakers) openLocked(state *circuit, outcome requestOutcome, now time.Time) {
+	state.state = CircuitOpen
+	state.trips++
+	state.openedAt = now
+	state.retryAt = now.Add(state.cooldown)
+	if outcome.blocked > 0 {
+		state.reason = fmt.Sprintf("%d réponse(s) de blocage", outcome.blocked)
+	} else {
+		state.reason = fmt.Sprintf("%d erreur(s) sur %d requête(s)", outcome.failures, outcome.requests)
+	}
+}
+
+/**
+ * notify envoie un changement d'état sur le chat d'administration.
+ * @param {string} message - Le message.
+ * @return {void}
+ */
+func (breakers *CircuitBreakers) notify(message string) {
+	log.Println(message)
+	if breakers.notifier != nil {
+		breakers.notifier.NotifyAdmin(message)
+	}
+}
+
+/**
+ * Statuses retourne l'état des disjoncteurs des agences déjà scrapées, triés par agence.
+ * @return {[]CircuitStatus} - Les états des disjoncteurs.
+ */
+func (breakers *CircuitBreakers) Statuses() []CircuitStatus {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	statuses := make([]CircuitStatus, 0, len(breakers.circuits))
+	for agency, state := range breakers.circuits {
+		status := CircuitStatus{Agency: agency, State: state.state, Trips: state.trips, Reason: state.reason}
+		if state.state != CircuitClosed {
+			openedAt, retryAt := state.openedAt, state.retryAt
+			status.OpenedAt = &openedAt
+			status.RetryAt = &retryAt
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Agency < statuses[j].Agency })
+	return statuses
+}
+
+/**
+ * trackOutcomes compte les requêtes d'un collecteur et leurs échecs, pour le disjoncteur de l'agence.
+ * @param {colly.Collector} collector - Le collecteur.
+ * @return {void}
+ */
+func (collyService *CollyService) trackOutcomes(collector *colly.Collector) {
+	collector.OnResponse(func(r *colly.Response) {
+		collyService.outcomeMu.Lock()
+		defer collyService.outcomeMu.Unlock()
+
+		collyService.outcome.requests++
+		if isBlockPage(r.Body) {
+			collyService.outcome.failures++
+			collyService.outcome.blocked++
+		}
+	})
+
+	collector.OnError(func(r *colly.Response, err error) {
+		// Page de résultats inchangée (cache HTTP) : requête interrompue volontairement
+		if errors.Is(err, colly.ErrAbortedAfterHeaders) {
+			return
+		}
+
+		collyService.outcomeMu.Lock()
+		defer collyService.outcomeMu.Unlock()
+
+		collyService.outcome.requests++
+		collyService.outcome.failures++
+		// Un refus du proxy (407) ne dit rien de l'agence
+		if blockStatusCodes[r.StatusCode] && r.StatusCode != http.StatusProxyAuthRequired {
+			collyService.outcome.blocked++
+		}
+	})
+}
+
+/**
+ * Outcome retourne les requêtes du cycle et leurs échecs.
+ * @return {requestOutcome} - Les requêtes du cycle.
+ */
+func (collyService *CollyService) Outcome() requestOutcome {
+	collyService.outcomeMu.Lock()
+	defer collyService.outcomeMu.Unlock()
+
+	return collyService.outcome
+}
+
+/**
+ * SetCircuitBreaker associe le disjoncteur de l'agence au cycle, pour l'interrompre dès qu'il s'ouvre.
+ * @param {*CircuitBreakers} breakers - Les disjoncteurs des agences.
+ * @param {bool} probe - Vrai si le cycle est une sonde : seule la première page de résultats est demandée.
+ * @return {void}
+ */
+func (collyService *CollyService) SetCircuitBreaker(breakers *CircuitBreakers, probe bool) {
+	collyService.breakers = breakers
+	collyService.probe = probe
+}
+
+/**
+ * Tripped indique si le disjoncteur de l'agence doit s'ouvrir avec les requêtes déjà envoyées pendant le cycle.
+ * Le résultat d'un cycle interrompu est incomplet : il ne doit pas être enregistré.
+ * @return {bool} - Vrai si le cycle doit être interrompu.
+ */
+func (collyService *CollyService) Tripped() bool {
+	return collyService.breakers != nil && collyService.breakers.Trips(collyService.Outcome(), collyService.probe)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+/**
+ * loadCertPool charge les certificats des autorités de confiance : ceux du système, complétés par un fichier PEM.
+ * @param {string} path - Le fichier PEM des certificats supplémentaires.
+ * @return {*x509.CertPool} - Les autorités de confiance.
+ * @return {error} - Erreur si le fichier est illisible ou ne contient aucun certificat.
+ */
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("lecture des certificats %s : %w", path, err)
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("aucun certificat PEM dans %s", path)
+	}
+	return pool, nil
+}
+
+/**
+ * newTLSConfig crée la configuration TLS d'une agence : vérification des certificats par défaut,
+ * avec les autorités du fichier caFile, ou sans vérification si l'agence l'a désactivée.
+ * @param {AgencySettings} settings - Les réglages de l'agence.
+ * @return {*tls.Config} - La configuration TLS.
+ * @return {error} - Erreur si les certificats supplémentaires ne peuvent pas être chargés.
+ */
+func newTLSConfig(settings AgencySettings) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: settings.InsecureSkipVerify, // Désactivation explicite, agence par agence
+	}
+	if settings.CAFile == "" {
+		return config, nil
+	}
+
+	pool, err := loadCertPool(settings.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+/**
+ * describeTLSError remplace une erreur de vérification de certificat par un message explicite.
+ * Les autres erreurs sont retournées telles quelles.
+ * @param {error} err - L'erreur de la requête.
+ * @return {error} - L'erreur, expliquée s'il s'agit d'un certificat invalide.
+ */
+func describeTLSError(err error) error {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+
+	var reason string
+	switch {
+	case errors.As(err, &unknownAuthority):
+		reason = "chaîne de certificats incomplète ou autorité inconnue (ajoutez l'autorité avec caFile)"
+	case errors.As(err, &hostname):
+		reason = fmt.Sprintf("le certificat ne correspond pas au domaine %s", hostname.Host)
+	case errors.As(err, &invalid):
+		reason = "certificat expiré ou invalide"
+	default:
+		return err
+	}
+	return fmt.Errorf("certificat TLS refusé : %s : %w", reason, err)
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strings"
-	"time"
+	"sync/atomic"
 
 	"github.com/gocolly/colly/v2"
 )
@@ -15,10 +15,34 @@ import (
  * Announcement est une structure pour stocker les informations sur les annonces de bien immobilier.
  * @property {string} propertyReference - Référence du bien immobilier.
  * @property {string} url - URL de la page de détails de l'annonce.
+ * @property {string} title - Titre de l'annonce.
+ * @property {float64} price - Loyer ou prix en euros.
+ * @property {float64} surface - Surface en m².
+ * @property {int} rooms - Nombre de pièces.
+ * @property {string} city - Ville du bien.
+ * @property {string} photo - URL de la photo principale.
+ * @property {float64} latitude - Latitude du bien, si l'agence l'affiche sur une carte.
+ * @property {float64} longitude - Longitude du bien, si l'agence l'affiche sur une carte.
+ * @property {float64} agencyFees - Honoraires d'agence en euros (à la charge de l'acquéreur pour une vente).
+ * @property {float64} coOwnershipCharges - Charges de copropriété annuelles en euros.
+ * @property {int} lots - Nombre de lots de la copropriété.
+ * @property {string} energyClass - Classe énergie du DPE, de A à G.
  */
 type Announcement struct {
-	propertyReference string
-	url               string
+	propertyReference  string
+	url                string
+	title              string
+	price              float64
+	surface            float64
+	rooms              int
+	city               string
+	photo              string
+	latitude           float64
+	longitude          float64
+	agencyFees         float64
+	coOwnershipCharges float64
+	lots               int
+	energyClass        string
 }
 
 /**
@@ -30,74 +54,120 @@ func (collyService *CollyService) ScrapeAnnouncement(agency Agency, url string)
 	// Slice pour stocker les URLs des pages de détails
 	var detailPageURLs []string
 
+	// Slice pour stocker les annonces trouvées dans l'état JSON embarqué dans la page
+	var stateAnnouncements []Announcement
+
+	// Slice pour stocker les annonces sans page de détails (cartes sans lien)
+	var cardAnnouncements []Announcement
+
 	// Afficher un message de démarrage
 	fmt.Println("Démarrage du scraping des annonces immobilières de l'agence :", agency)
 
-	// Ignorer les erreurs de certificat TLS
-	collyService.collector.WithTransport(&http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	})
+	// Initialiser ou renouveler la session (cookies, consentement) avant la première page de résultats
+	collyService.ensureSession()
 
-	// Ajouter un paramètre unique à chaque requête pour invalider le cache
-	collyService.collector.OnRequest(func(r *colly.Request) {
-		r.URL.RawQuery += "&_=" + fmt.Sprintf("%d", time.Now().UnixNano())
-	})
+	// Sonde du disjoncteur : une seule requête, qui ne doit pas être servie par le cache HTTP
+	var entryHeader http.Header
+	if collyService.probe {
+		var sent int64
+		collyService.collector.OnRequest(func(r *colly.Request) {
+			if atomic.AddInt64(&sent, 1) > 1 {
+				r.Abort()
+			}
+		})
+		entryHeader = http.Header{"Cache-Control": []string{"no-cache"}}
+	}
+
+	// Lire l'état JSON embarqué pour les sites Angular et SPA, les sélecteurs CSS servent de repli
+	if embeddedStateAgencies[agency] {
+		setupEmbeddedStateExtraction(collyService.collector, &stateAnnouncements)
+	}
 
-	// Utiliser un switch pour configurer les callbacks spécifiques à l'agence
-	switch agency {
-	case Afedim:
+	// Utiliser l'adaptateur de la plateforme du site, sinon les callbacks spécifiques à l'agence
+	adapter, hasAdapter := findSiteAdapter(agency)
+	switch {
+	case hasAdapter:
+		adapter.setupMainPage(collyService.collector, &detailPageURLs)
+	case agency == Afedim:
 		setupMainPageAfedim(collyService.collector, &detailPageURLs)
-	case Giboire:
+	case agency == Giboire:
 		setupMainPageGiboire(collyService.collector, &detailPageURLs)
-	case Foncia:
+	case agency == Foncia:
 		setupMainPageFoncia(collyService.collector, &detailPageURLs)
-	case AgenceDuColombier:
-		setupMainPageAgenceDuColombier(collyService.collector, &detailPageURLs)
-	case LaFrancaiseImmobiliere:
-		setupMainPageLaFrancaiseImmobiliere(collyService.collector, &detailPageURLs)
-	case Guenno:
+	case agency == Guenno:
 		setupMainPageGuenno(collyService.collector, &detailPageURLs)
-	case LaMotte:
+	case agency == LaMotte:
 		setupMainPageLaMotte(collyService.collector, &detailPageURLs)
-	case Kermarrec:
+	case agency == Kermarrec:
 		setupMainPageKermarrec(collyService.collector, &detailPageURLs)
-	case Nestenn:
+	case agency == Nestenn:
 		setupMainPageNestenn(collyService.collector, &detailPageURLs)
-	case SquareHabitat:
-		setupMainPageSquareHabitat(collyService.collector, &detailPageURLs)
-	case CAImmobilier:
+	case agency == SquareHabitat:
+		setupMainPageSquareHabitat(collyService.collector, &detailPageURLs, &cardAnnouncements)
+	case agency == CAImmobilier:
 		setupMainPageCAImmobilier(collyService.collector, &detailPageURLs)
-	case PigeaultImmobilier:
-		setupMainPagePigeaultImmobilier(collyService.collector, &detailPageURLs)
-	case LaForetImmobilier:
+	case agency == LaForetImmobilier:
 		setupMainPageLaForetImmobilier(collyService.collector, &detailPageURLs)
-	case Cogir:
+	case agency == Cogir:
 		setupMainPageCogir(collyService.collector, &detailPageURLs)
 	default:
 		log.Fatalf("Agence inconnue : %s", agency)
 	}
 
+	// Page de résultats inchangée depuis le cycle précédent (cache HTTP) : reprendre les annonces sans analyser la page
+	collyService.collector.OnResponseHeaders(func(r *colly.Response) {
+		if r.Headers.Get(cacheStatusHeader) != "" && r.Ctx.Get(entryPageKey) != "" && len(collyService.previousListings) > 0 {
+			collyService.notModified = true
+			r.Request.Abort()
+		}
+	})
+
 	// Gestion des erreurs pour la page principale
 	collyService.collector.OnError(func(_ *colly.Response, err error) {
+		if collyService.notModified && errors.Is(err, colly.ErrAbortedAfterHeaders) {
+			return
+		}
+		err = describeTLSError(err)
 		log.Printf("Erreur pendant le scraping de la page principale : %v", err)
+		collyService.recordError(err)
+		collyService.markIncomplete()
 	})
 
 	// Démarrer le scraping de la page principale
-	if err := collyService.collector.Visit(url); err != nil {
+	entryContext := colly.NewContext()
+	entryContext.Put(entryPageKey, "1")
+	if err := collyService.collector.Request("GET", url, nil, entryContext, entryHeader); err != nil {
 		log.Printf("Erreur lors de la visite de l'URL principale : %v", err)
+		collyService.recordError(err)
+		collyService.markIncomplete()
 	}
 
 	// Attendre la fin des requêtes asynchrones
 	collyService.collector.Wait()
 
-	if agency == SquareHabitat {
-		// La référence devient la description pour Square Habitat
-		var announcements []Announcement
-		for _, ref := range detailPageURLs {
-			announcements = append(announcements, Announcement{propertyReference: ref, url: ""})
-		}
-		return announcements
-	} else if agency == CAImmobilier {
+	// Le résultat d'une sonde ou d'un cycle interrompu par le disjoncteur est incomplet
+	if collyService.probe {
+		return nil
+	}
+	if collyService.Tripped() {
+		log.Printf("Disjoncteur de l'agence %s déclenché par la page de résultats, pages de détails non visitées", agency)
+		return nil
+	}
+
+	if collyService.notModified {
+		fmt.Printf("Page de résultats inchangée pour l'agence %s, %d annonce(s) reprise(s) du cycle précédent\n", agency, len(collyService.previousListings))
+		return collyService.previousListings
+	}
+
+	// L'état JSON est plus complet et moins fragile que les sélecteurs CSS : il est utilisé en priorité
+	if len(stateAnnouncements) > 0 {
+		fmt.Printf("%d annonce(s) trouvée(s) dans l'état JSON de la page de l'agence %s\n", len(stateAnnouncements), agency)
+		return stateAnnouncements
+	} else if embeddedStateAgencies[agency] {
+		log.Printf("Aucune annonce dans l'état JSON de la page de l'agence %s, repli sur les sélecteurs CSS", agency)
+	}
+
+	if agency == CAImmobilier {
 		// La référence devient la description pour CA Immobilier
 		var announcements []Announcement
 		for _, ref := range detailPageURLs {
@@ -120,7 +190,7 @@ func (collyService *CollyService) ScrapeAnnouncement(agency Agency, url string)
 	}
 
 	// Récupérer les annonces complètes (références et URLs)
-	return collyService.processDetailPages(detailPageURLs, agency)
+	return append(collyService.processDetailPages(detailPageURLs, agency), cardAnnouncements...)
 }
 
 /**
@@ -132,44 +202,41 @@ func (collyService *CollyService) processDetailPages(detailPageURLs []string, ag
 	// Slice pour stocker les annonces
 	var announcements []Announcement
 
-	// Créer un nouveau collector pour les pages de détails
-	detailCollector := colly.NewCollector()
+	// Caractéristiques communes (prix, surface...) extraites de chaque page de détails
+	details := make(map[string]Announcement)
 
-	// Ignorer les erreurs de certificat TLS
-	detailCollector.WithTransport(&http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	})
+	// Créer un nouveau collector pour les pages de détails, avec les mêmes limites et proxies que la page principale
+	// (les pages de détails sont visitées une à une : le parallélisme est une borne, le délai s'applique)
+	detailCollector := colly.NewCollector()
+	collyService.applySettings(detailCollector)
 
-	// Ajouter un paramètre unique à chaque requête pour invalider le cache
-	detailCollector.OnRequest(func(r *colly.Request) {
-		r.URL.RawQuery += "&_=" + fmt.Sprintf("%d", time.Now().UnixNano())
-	})
+	// Extraire les caractéristiques communes avant les callbacks spécifiques à l'agence
+	setupDetailPageEnrichment(detailCollector, details)
 
-	// Utiliser un switch pour appeler la fonction spécifique à l'agence
-	switch agency {
-	case Afedim:
+	// Utiliser l'adaptateur de la plateforme du site, sinon la fonction spécifique à l'agence
+	adapter, hasAdapter := findSiteAdapter(agency)
+	switch {
+	case hasAdapter:
+		adapter.processDetailPages(detailCollector, &announcements)
+	case agency == Afedim:
 		processDetailPagesAfedim(detailCollector, &announcements)
-	case Giboire:
+	case agency == Giboire:
 		processDetailPagesGiboire(detailCollector, &announcements)
-	case Foncia:
+	case agency == Foncia:
 		processDetailPagesFoncia(detailCollector, &announcements)
-	case AgenceDuColombier:
-		processDetailPagesAgenceDuColombier(detailCollector, &announcements)
-	case LaFrancaiseImmobiliere:
-		processDetailPagesLaFrancaiseImmobiliere(detailCollector, &announcements)
-	case Guenno:
+	case agency == Guenno:
 		processDetailPagesGuenno(detailCollector, &announcements)
-	case LaMotte:
+	case agency == LaMotte:
 		processDetailPagesLaMotte(detailCollector, &announcements)
-	case Kermarrec:
+	case agency == Kermarrec:
 		processDetailPagesKermarrec(detailCollector, &announcements)
-	case Nestenn:
+	case agency == Nestenn:
 		processDetailPagesNestenn(detailCollector, &announcements)
-	case PigeaultImmobilier:
-		processDetailPagesPigeaultImmobilier(detailCollector, &announcements)
-	case LaForetImmobilier:
+	case agency == SquareHabitat:
+		processDetailPagesSquareHabitat(detailCollector, &announcements)
+	case agency == LaForetImmobilier:
 		processDetailPagesLaForetImmobilier(detailCollector, &announcements)
-	case Cogir:
+	case agency == Cogir:
 		processDetailPagesCogir(detailCollector, &announcements)
 	default:
 		log.Fatalf("Agence inconnue : %s", agency)
@@ -177,20 +244,52 @@ func (collyService *CollyService) processDetailPages(detailPageURLs []string, ag
 
 	// Gestion des erreurs pour les détails
 	detailCollector.OnError(func(_ *colly.Response, err error) {
+		err = describeTLSError(err)
 		log.Printf("Erreur pendant le scraping de la page de détails : %v", err)
+		collyService.recordError(err)
+		collyService.markIncomplete()
 	})
 
-	// Visiter chaque URL dans la slice
-	for _, url := range detailPageURLs {
+	// Visiter chaque URL dans la slice, sauf les pages déjà visitées récemment
+	skipped := 0
+	for i, url := range detailPageURLs {
+		// Arrêter les visites dès que le disjoncteur s'ouvre, plutôt que d'enchaîner les erreurs
+		if collyService.Tripped() {
+			log.Printf("Disjoncteur de l'agence %s déclenché : %d page(s) de détails non visitée(s)", agency, len(detailPageURLs)-i)
+			break
+		}
+
+		if known, exists := collyService.knownListings[url]; exists {
+			announcements = append(announcements, known)
+			collyService.detailPages = append(collyService.detailPages, detailPage{url: url, reference: known.propertyReference})
+			skipped++
+			continue
+		}
+
 		fmt.Println("Visite de la page de détails :", url)
+		found := len(announcements)
 		if err := detailCollector.Visit(url); err != nil {
 			log.Printf("Erreur lors de la visite de la page de détails : %v", err)
+			collyService.markIncomplete()
 		}
+
+		// Le collecteur des détails est synchrone : les annonces ajoutées viennent de cette page
+		page := detailPage{url: url, fetched: true}
+		if len(announcements) > found {
+			page.reference = canonicalReference(agency, announcements[found].propertyReference, announcements[found].url)
+		}
+		collyService.detailPages = append(collyService.detailPages, page)
+	}
+	if skipped > 0 {
+		fmt.Printf("%d page(s) de détails déjà connue(s) non revisitée(s) pour l'agence %s\n", skipped, agency)
 	}
 
 	// Attendre la fin des requêtes asynchrones
 	detailCollector.Wait()
 
+	// Compléter les annonces avec les caractéristiques de leur page de détails
+	mergeAnnouncementDetails(announcements, details)
+
 	// Retourner toutes les annonces trouvées
 	return announcements
 }
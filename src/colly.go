@@ -1,7 +1,10 @@
 package main
 
 import (
-	"time"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"sync"
 
 	"github.com/gocolly/colly/v2"
 )
@@ -10,73 +13,139 @@ import (
  * CollyService est une structure qui encapsule le collecteur Colly pour le scraping de données.
  * @property {colly.Collector} collector - Instance du collecteur Colly pour le scraping.
  * @property {chan error} errChan - Canal pour signaler les erreurs pendant le scraping.
+ * @property {sync.Mutex} errMu - Verrou protégeant la liste des erreurs.
+ * @property {[]error} errs - Erreurs rencontrées pendant le scraping, pour la santé de l'agence.
+ * @property {bool} incomplete - Vrai si des pages du cycle n'ont pas pu être lues (erreur ou nombre maximal de requêtes atteint).
+ * @property {AgencySettings} settings - Réglages HTTP de l'agence (parallélisme, délais, nombre de requêtes).
+ * @property {int64} requests - Nombre de requêtes envoyées pendant le cycle.
+ * @property {Agency} agency - L'agence scrapée.
+ * @property {*ProxyPool} proxies - Le pool de proxies, nil si les requêtes de l'agence partent directement.
+ * @property {HeaderProfile} headerProfile - Le profil d'en-têtes du navigateur imité pendant la session.
+ * @property {refererChain} referers - La dernière page visitée pendant la session, pour l'en-tête Referer.
+ * @property {map[string]Announcement} knownListings - Les annonces dont la page de détails n'est pas revisitée, indexées par URL.
+ * @property {[]detailPage} detailPages - Les pages de détails du cycle, visitées ou reprises du store.
+ * @property {[]Announcement} previousListings - Les annonces du cycle précédent, reprises si la page de résultats n'a pas changé.
+ * @property {bool} notModified - Vrai si la page de résultats n'a pas changé depuis le cycle précédent.
+ * @property {*SessionJar} jar - Le cookie jar persistant de la session de l'agence, nil si l'agence n'a pas de session.
+ * @property {sync.Mutex} outcomeMu - Verrou protégeant le décompte des requêtes.
+ * @property {requestOutcome} outcome - Les requêtes du cycle et leurs échecs, pour le disjoncteur de l'agence.
+ * @property {*CircuitBreakers} breakers - Les disjoncteurs des agences, nil si le cycle n'est pas surveillé.
+ * @property {bool} probe - Vrai si le cycle est une sonde du disjoncteur : seule la première page de résultats est demandée.
  */
 type CollyService struct {
-	collector *colly.Collector
-	errChan   chan error
-}
+	collector  *colly.Collector
+	errChan    chan error
+	errMu      sync.Mutex
+	errs       []error
+	incomplete bool
+	settings   AgencySettings
+	requests   int64
+	agency     Agency
+	proxies    *ProxyPool
 
-// Liste des User-Agents pour éviter le blocage
-/*var userAgents = []string{
-	"Mozilla/5.0 (Windows NT 10.0; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/62.0.3328.95 Safari/537.36 QIHU 360SE",
-	"Mozilla/5.0 (Linux; Android 14; SM-M136B Build/UP1A.231005.007; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/130.0.6723.106 Mobile Safari/537.36 WebView MetaMaskMobile",
-	"Mozilla/5.0 (Linux; U; Android 14; en-gb; RMX3612 Build/UKQ1.230924.001) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.88 Mobile Safari/537.36 HeyTapBrowser/45.11.4.1",
-	"Mozilla/5.0 (Linux; Android 13; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/111.0.5563.116 Mobile Safari/537.36",
-	"Mozilla/5.0 (Linux; Android 12; RMX3690 Build/SP1A.210812.016) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.6723.107 Mobile Safari/537.36",
-	"Mozilla/5.0 (Macintosh; Intel Mac OS X 11.12; rv:131.0) Gecko/20010101 Firefox/131.0",
-	"Mozilla/5.0 (Windows NT 10.0; WOW64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.6556.192 Safari/537.36",
-	"Mozilla/5.0 (Windows NT 6.2; Win64; x64; rv:132.0esr) Gecko/20100101 Firefox/132.0esr/0YoBqLP7z7eKob-09",
-	"Mozilla/5.0 (Linux; Android 12; NCO-LX1; HMSCore 6.14.0.322) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.5735.196 HuaweiBrowser/15.0.4.312 Mobile Safari/537.36",
-	"Mozilla/5.0 (Linux; Android 14; SM-S918U1 Build/UP1A.231005.007; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/130.0.6723.106 Mobile Safari/537.36",
-	"Mozilla/5.0 (iPad; CPU OS 17_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/128.0.6613.92 Mobile/15E148 Safari/604.1",
-	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:106.0) Gecko/20100101 Firefox/106.0",
-	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.93 Safari/537.36",
-	"Mozilla/5.0 (Windows NT 10.0; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/106.0.0.0 YaBrowser/22.11.2.803 Yowser/2.5 Safari/537.36",
-	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/103.0.5060.114 Safari/537.36",
-	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/88.0.4324.182 Safari/537.36",
-	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 OPR/106.0.0.0",
-	"Mozilla/5.0 (Windows NT 10.0; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/106.0.0.0 YaBrowser/22.11.5.711 Yowser/2.5 Safari/537.36",
-	"Mozilla/5.0 (Macintosh; Intel Mac OS X 11.12; rv:131.0) Gecko/20010101 Firefox/131.0",
-	"Mozilla/5.0 (Linux; Android 14; SM-M136B Build/UP1A.231005.007; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/130.0.6723.106 Mobile Safari/537.36 WebView MetaMaskMobile",
-}
+	headerProfile HeaderProfile
+	referers      refererChain
+	knownListings map[string]Announcement
+	detailPages   []detailPage
 
-// Générateur de nombres aléatoires
-var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	previousListings []Announcement
+	notModified      bool
 
-/**
- * randomUserAgent retourne un User-Agent aléatoire pour éviter le blocage.
- * @return {string} - User-Agent aléatoire.
-*/
-/*func randomUserAgent() string {
-	return userAgents[random.Intn(len(userAgents))]
-}*/
+	jar *SessionJar
+
+	outcomeMu sync.Mutex
+	outcome   requestOutcome
+	breakers  *CircuitBreakers
+	probe     bool
+}
 
 /**
  * NewCollyService crée une nouvelle instance de CollyService avec une configuration de collecteur prédéfinie.
+ * @param {Agency} agency - L'agence scrapée.
+ * @param {AgencySettings} settings - Réglages HTTP de l'agence.
+ * @param {*ProxyPool} proxies - Le pool de proxies, nil pour des requêtes directes.
  * @return {CollyService} - Retourne une instance configurée de CollyService.
  */
-func NewCollyService() *CollyService {
+func NewCollyService(agency Agency, settings AgencySettings, proxies *ProxyPool) *CollyService {
 	// Configuration de base du collecteur
 	c := colly.NewCollector(
-		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"), // User-Agent pour éviter le blocage
 		colly.IgnoreRobotsTxt(), // Ignorer les règles du fichier robots.txt
 		colly.MaxDepth(1),       // Limiter la profondeur de recherche à 1 pour éviter les liens externes
 		colly.Async(true),       // Activer le mode asynchrone pour le scraping
 		colly.DetectCharset(),   // Détecter automatiquement l'encodage de la page
 	)
 
-	// Définition des limites de requêtes pour éviter les blocages
-	c.Limit(&colly.LimitRule{
-		DomainGlob:  "*",             // Applique cette règle à tous les domaines visités par le collecteur
-		Parallelism: 2,               // Limite à 2 requêtes simultanées pour ne pas surcharger le serveur
-		Delay:       2 * time.Second, // Attente de 2 secondes entre chaque requête pour éviter un blocage par le serveur
-	})
-
 	// Retourne une nouvelle instance de CollyService avec un canal d'erreur
-	return &CollyService{
+	collyService := &CollyService{
 		collector: c,
 		errChan:   make(chan error), // Initialiser le canal d'erreurs
+		settings:  settings,
+		agency:    agency,
+
+		// Un profil de navigateur par session, pour des en-têtes cohérents d'une requête à l'autre
+		headerProfile: pickHeaderProfile(settings),
+	}
+	if proxies.Uses(agency) {
+		collyService.proxies = proxies
+	}
+	if settings.Session != nil {
+		// Les cookies de la session sont partagés par les collecteurs et conservés d'un cycle à l'autre
+		collyService.jar = OpenSessionJar(settings.sessionDir, agency)
+	}
+
+	// Définition des limites de requêtes de l'agence pour éviter les blocages
+	collyService.applySettings(c)
+
+	return collyService
+}
+
+/**
+ * newTransport crée le transport HTTP des collecteurs de l'agence, avec sa configuration TLS et le pool de proxies s'il y en a un.
+ * Le transport doit être créé ici : WithTransport remplace aussi le choix du proxy.
+ * @return {http.RoundTripper} - Le transport.
+ */
+func (collyService *CollyService) newTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	// Vérifier les certificats TLS, sauf si l'agence l'a désactivé
+	tlsConfig, err := newTLSConfig(collyService.settings)
+	if err != nil {
+		log.Printf("Certificats supplémentaires de l'agence %s ignorés : %v", collyService.agency, err)
+		collyService.recordError(err)
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
 	}
+	transport.TLSClientConfig = tlsConfig
+
+	if collyService.proxies != nil {
+		return collyService.proxies.Transport(collyService.agency, transport)
+	}
+	return transport
+}
+
+/**
+ * SetKnownListings définit les annonces dont la page de détails a été visitée récemment et n'est pas revisitée.
+ * @param {map[string]Announcement} known - Les annonces connues, indexées par URL de la page de détails.
+ * @return {void}
+ */
+func (collyService *CollyService) SetKnownListings(known map[string]Announcement) {
+	collyService.knownListings = known
+}
+
+/**
+ * SetPreviousListings définit les annonces du cycle précédent, reprises si la page de résultats n'a pas changé.
+ * @param {[]Announcement} previous - Les annonces actives de l'agence.
+ * @return {void}
+ */
+func (collyService *CollyService) SetPreviousListings(previous []Announcement) {
+	collyService.previousListings = previous
+}
+
+/**
+ * DetailPages retourne les pages de détails du cycle, visitées ou reprises du store.
+ * @return {[]detailPage} - Les pages de détails.
+ */
+func (collyService *CollyService) DetailPages() []detailPage {
+	return collyService.detailPages
 }
 
 /**
@@ -86,3 +155,49 @@ func NewCollyService() *CollyService {
 func (collyService *CollyService) ErrorChannel() <-chan error {
 	return collyService.errChan
 }
+
+/**
+ * recordError enregistre une erreur rencontrée pendant le scraping.
+ * @param {error} err - L'erreur à enregistrer.
+ * @return {void}
+ */
+func (collyService *CollyService) recordError(err error) {
+	collyService.errMu.Lock()
+	defer collyService.errMu.Unlock()
+
+	collyService.errs = append(collyService.errs, err)
+}
+
+/**
+ * markIncomplete signale qu'une page du cycle n'a pas pu être lue : les annonces absentes ne doivent pas être retirées.
+ * @return {void}
+ */
+func (collyService *CollyService) markIncomplete() {
+	collyService.errMu.Lock()
+	defer collyService.errMu.Unlock()
+
+	collyService.incomplete = true
+}
+
+/**
+ * Incomplete indique si des pages du cycle n'ont pas pu être lues (erreur, nombre maximal de requêtes atteint).
+ * Une annonce absente des résultats d'un cycle incomplet peut simplement ne pas avoir été lue.
+ * @return {bool} - Vrai si le cycle est incomplet.
+ */
+func (collyService *CollyService) Incomplete() bool {
+	collyService.errMu.Lock()
+	defer collyService.errMu.Unlock()
+
+	return collyService.incomplete
+}
+
+/**
+ * Errors retourne les erreurs rencontrées pendant le scraping.
+ * @return {[]error} - Les erreurs.
+ */
+func (collyService *CollyService) Errors() []error {
+	collyService.errMu.Lock()
+	defer collyService.errMu.Unlock()
+
+	return append([]error(nil), collyService.errs...)
+}
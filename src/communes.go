@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/**
+ * Commune est une commune française, avec les codes utilisés par les sites des agences pour la désigner.
+ * @property {string} Name - Le nom de la commune (ex: "Cesson-Sévigné").
+ * @property {string} INSEE - Le code officiel géographique de la commune (ex: "35051").
+ * @property {[]string} PostalCodes - Les codes postaux de la commune, le principal en premier.
+ */
+type Commune struct {
+	Name        string   `json:"name"`
+	INSEE       string   `json:"insee"`
+	PostalCodes []string `json:"postalCodes"`
+}
+
+/**
+ * Department est un département, pour les sites dont l'URL de recherche contient le département ou la région.
+ * @property {string} Name - Le nom du département (ex: "Ille-et-Vilaine").
+ * @property {string} Region - Le nom de la région (ex: "Bretagne").
+ */
+type Department struct {
+	Name   string
+	Region string
+}
+
+/**
+ * communes liste les communes connues du scraper : Rennes et sa métropole.
+ * D'autres communes s'ajoutent dans la configuration (communes).
+ */
+var communes = []Commune{
+	{Name: "Rennes", INSEE: "35238", PostalCodes: []string{"35000", "35200", "35700"}},
+	{Name: "Cesson-Sévigné", INSEE: "35051", PostalCodes: []string{"35510"}},
+	{Name: "Chantepie", INSEE: "35055", PostalCodes: []string{"35135"}},
+	{Name: "Saint-Grégoire", INSEE: "35278", PostalCodes: []string{"35760"}},
+	{Name: "Saint-Jacques-de-la-Lande", INSEE: "35281", PostalCodes: []string{"35136"}},
+	{Name: "Bruz", INSEE: "35047", PostalCodes: []string{"35170"}},
+	{Name: "Betton", INSEE: "35024", PostalCodes: []string{"35830"}},
+	{Name: "Pacé", INSEE: "35210", PostalCodes: []string{"35740"}},
+	{Name: "Thorigné-Fouillard", INSEE: "35334", PostalCodes: []string{"35235"}},
+	{Name: "Vezin-le-Coquet", INSEE: "35353", PostalCodes: []string{"35132"}},
+	{Name: "Le Rheu", INSEE: "35240", PostalCodes: []string{"35650"}},
+	{Name: "Chartres-de-Bretagne", INSEE: "35066", PostalCodes: []string{"35131"}},
+	{Name: "Acigné", INSEE: "35001", PostalCodes: []string{"35690"}},
+	{Name: "Montgermont", INSEE: "35189", PostalCodes: []string{"35760"}},
+}
+
+/**
+ * departments liste les départements connus, indexés par code.
+ */
+var departments = map[string]Department{
+	"22": {Name: "Côtes-d'Armor", Region: "Bretagne"},
+	"29": {Name: "Finistère", Region: "Bretagne"},
+	"35": {Name: "Ille-et-Vilaine", Region: "Bretagne"},
+	"44": {Name: "Loire-Atlantique", Region: "Pays de la Loire"},
+	"53": {Name: "Mayenne", Region: "Pays de la Loire"},
+	"56": {Name: "Morbihan", Region: "Bretagne"},
+}
+
+/**
+ * Validate vérifie que la commune a un nom, un code INSEE et au moins un code postal.
+ * @return {error} - La première erreur trouvée.
+ */
+func (commune Commune) Validate() error {
+	switch {
+	case commune.Name == "":
+		return fmt.Errorf("commune sans nom")
+	case !isCommuneCode(commune.INSEE):
+		return fmt.Errorf("commune %q : code INSEE invalide %q", commune.Name, commune.INSEE)
+	case len(commune.PostalCodes) == 0:
+		return fmt.Errorf("commune %q : aucun code postal", commune.Name)
+	}
+	for _, postalCode := range commune.PostalCodes {
+		if !isCommuneCode(postalCode) {
+			return fmt.Errorf("commune %q : code postal invalide %q", commune.Name, postalCode)
+		}
+	}
+	return nil
+}
+
+/**
+ * isCommuneCode indique si un texte est un code INSEE ou un code postal : cinq caractères, chiffres ou 2A/2B pour la Corse.
+ * @param {string} code - Le texte.
+ * @return {bool} - Vrai si le texte a la forme d'un code.
+ */
+func isCommuneCode(code string) bool {
+	if len(code) != 5 {
+		return false
+	}
+	for i, char := range code {
+		if (char < '0' || char > '9') && !(i == 1 && (char == 'A' || char == 'B')) {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+ * Slug retourne le nom de la commune utilisable dans une URL (ex: "cesson-sevigne").
+ * @return {string} - Le slug de la commune.
+ */
+func (commune Commune) Slug() string {
+	return slugReplacer.Replace(strings.ToLower(commune.Name))
+}
+
+/**
+ * UpperName retourne le nom de la commune en majuscules, sans accents ni tirets (ex: "CESSON SEVIGNE").
+ * @return {string} - Le nom.
+ */
+func (commune Commune) UpperName() string {
+	return strings.ToUpper(strings.ReplaceAll(commune.Slug(), "-", " "))
+}
+
+/**
+ * PostalCode retourne le code postal principal de la commune.
+ * @return {string} - Le code postal.
+ */
+func (commune Commune) PostalCode() string {
+	return commune.PostalCodes[0]
+}
+
+/**
+ * DepartmentCode retourne le code du département de la commune, tiré du code INSEE.
+ * @return {string} - Le code du département (ex: "35").
+ */
+func (commune Commune) DepartmentCode() string {
+	return commune.INSEE[:2]
+}
+
+/**
+ * Department retourne le département de la commune.
+ * @return {Department} - Le département.
+ * @return {bool} - Faux si le département est inconnu.
+ */
+func (commune Commune) Department() (Department, bool) {
+	department, exists := departments[commune.DepartmentCode()]
+	return department, exists
+}
+
+/**
+ * resolveCommunes retrouve les communes désignées par leur nom, leur code postal ou leur code INSEE.
+ * Un code postal partagé désigne toutes ses communes.
+ * @param {[]string} cities - Les noms ou codes des communes (ex: "Rennes", "35510", "35051").
+ * @param {[]Commune} extra - Les communes de la configuration, en plus des communes connues.
+ * @return {[]Commune} - Les communes, sans doublon, dans l'ordre de la liste.
+ * @return {error} - Erreur si une commune est inconnue.
+ */
+func resolveCommunes(cities []string, extra []Commune) ([]Commune, error) {
+	known := append(append([]Commune(nil), extra...), communes...)
+	seen := make(map[string]bool)
+	var resolved []Commune
+	for _, city := range cities {
+		matches := findCommunes(strings.TrimSpace(city), known)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("commune inconnue %q (à ajouter dans communes)", city)
+		}
+		for _, commune := range matches {
+			if !seen[commune.INSEE] {
+				seen[commune.INSEE] = true
+				resolved = append(resolved, commune)
+			}
+		}
+	}
+	return resolved, nil
+}
+
+/**
+ * findCommunes retrouve les communes correspondant à un nom, un code postal ou un code INSEE.
+ * Les accents, la casse et les tirets sont ignorés dans les noms.
+ * @param {string} city - Le nom ou le code.
+ * @param {[]Commune} known - Les communes connues.
+ * @return {[]Commune} - Les communes correspondantes.
+ */
+func findCommunes(city string, known []Commune) []Commune {
+	var matches []Commune
+	if isCommuneCode(city) {
+		for _, commune := range known {
+			for _, postalCode := range commune.PostalCodes {
+				if postalCode == city {
+					matches = append(matches, commune)
+					break
+				}
+			}
+		}
+		if len(matches) > 0 {
+			return matches
+		}
+		for _, commune := range known {
+			if commune.INSEE == city {
+				return []Commune{commune}
+			}
+		}
+		return nil
+	}
+
+	slug := slugReplacer.Replace(strings.ToLower(city))
+	for _, commune := range known {
+		if commune.Slug() == slug {
+			return []Commune{commune}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+/**
+ * Config est la configuration du scraper, lue depuis un fichier JSON.
+ * @property {[]SearchProfile} Profiles - Profils de recherche (exposés notamment en flux RSS).
+ * @property {map[string]AgencySettings} Agencies - Réglages propres à chaque agence, indexés par nom ou slug d'agence.
+ * @property {*ProxyConfig} Proxies - Pool de proxies par lequel passent les requêtes (aucun par défaut).
+ * @property {[]HeaderProfile} HeaderProfiles - Profils d'en-têtes de navigateur, remplacent les profils par défaut.
+ * @property {string} HTTPCacheDir - Dossier du cache HTTP des pages de résultats (défaut : data/http-cache).
+ * @property {string} SessionDir - Dossier des sessions des agences (défaut : data/sessions).
+ * @property {*BreakerConfig} CircuitBreaker - Seuils et temps de repos des disjoncteurs des agences (valeurs par défaut si nil).
+ * @property {int64} AdminChatID - Identifiant du chat Telegram d'administration, qui reçoit les alertes.
+ * @property {string} DashboardPassword - Mot de passe des actions du dashboard (sans mot de passe, seules les requêtes locales sont acceptées).
+ * @property {map[string]Schedule} Schedules - Planification des recherches de chaque agence, indexée par nom ou slug d'agence.
+ * @property {*Schedule} DefaultSchedule - Planification des agences sans planification (défaut : toutes les minutes).
+ * @property {string} Timezone - Fuseau horaire des heures actives et des expressions cron (défaut : Europe/Paris).
+ * @property {*SearchCriteria} Search - Critères de la recherche lancée sur chaque agence (DefaultSearchCriteria si nil).
+ * @property {[]SearchCriteria} SearchList - Critères supplémentaires, une transaction différente par bloc (ex: location et vente).
+ * @property {[]Commune} Communes - Communes ajoutées à celles connues du scraper, pour les critères de recherche.
+ */
+type Config struct {
+	Profiles          []SearchProfile           `json:"profiles"`
+	Agencies          map[string]AgencySettings `json:"agencies,omitempty"`
+	Proxies           *ProxyConfig              `json:"proxies,omitempty"`
+	HeaderProfiles    []HeaderProfile           `json:"headerProfiles,omitempty"`
+	HTTPCacheDir      string                    `json:"httpCacheDir,omitempty"`
+	SessionDir        string                    `json:"sessionDir,omitempty"`
+	CircuitBreaker    *BreakerConfig            `json:"circuitBreaker,omitempty"`
+	AdminChatID       int64                     `json:"adminChatID,omitempty"`
+	DashboardPassword string                    `json:"dashboardPassword,omitempty"`
+	Schedules         map[string]Schedule       `json:"schedules,omitempty"`
+	DefaultSchedule   *Schedule                 `json:"defaultSchedule,omitempty"`
+	Timezone          string                    `json:"timezone,omitempty"`
+	Search            *SearchCriteria           `json:"search,omitempty"`
+	SearchList        []SearchCriteria          `json:"searches,omitempty"`
+	Communes          []Commune                 `json:"communes,omitempty"`
+}
+
+/**
+ * SearchProfile est une recherche nommée appliquée aux annonces stockées.
+ * Les critères à zéro ne filtrent pas.
+ */
+type SearchProfile struct {
+	Name        string          `json:"name"`
+	Agencies    []Agency        `json:"agencies,omitempty"`
+	Transaction TransactionType `json:"transaction,omitempty"`
+	MinPrice    float64         `json:"minPrice,omitempty"`
+	MaxPrice    float64         `json:"maxPrice,omitempty"`
+	MinSurface  float64         `json:"minSurface,omitempty"`
+	MaxSurface  float64         `json:"maxSurface,omitempty"`
+	City        string          `json:"city,omitempty"`
+}
+
+/**
+ * LoadConfig lit et valide le fichier de configuration.
+ * Si le fichier n'existe pas, une configuration vide est retournée.
+ * @param {string} path - Chemin du fichier JSON.
+ * @return {*Config} - La configuration.
+ * @return {error} - Erreur si le fichier est illisible ou invalide.
+ */
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lecture de la configuration %s : %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("décodage de la configuration %s : %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("configuration %s invalide : %w", path, err)
+	}
+
+	return config, nil
+}
+
+/**
+ * Validate vérifie la cohérence de la configuration.
+ * @return {error} - La première erreur trouvée.
+ */
+func (config *Config) Validate() error {
+	names := make(map[string]bool)
+	for i, profile := range config.Profiles {
+		if profile.Name == "" {
+			return fmt.Errorf("profil n°%d sans nom", i+1)
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("profil %q défini plusieurs fois", profile.Name)
+		}
+		names[profile.Name] = true
+
+		for _, agency := range profile.Agencies {
+			if _, exists := findAgency(string(agency)); !exists {
+				return fmt.Errorf("profil %q : agence inconnue %q", profile.Name, agency)
+			}
+		}
+		switch profile.Transaction {
+		case "", TransactionRent, TransactionSale:
+		default:
+			return fmt.Errorf("profil %q : transaction inconnue %q", profile.Name, profile.Transaction)
+		}
+	}
+
+	if err := validateHeaderProfiles(config.HeaderProfiles); err != nil {
+		return err
+	}
+	headerProfiles := config.HeaderProfiles
+	if len(headerProfiles) == 0 {
+		headerProfiles = defaultHeaderProfiles
+	}
+
+	for name, settings := range config.Agencies {
+		if _, exists := findAgency(name); !exists {
+			return fmt.Errorf("réglages d'une agence inconnue : %q", name)
+		}
+		if err := settings.Validate(); err != nil {
+			return fmt.Errorf("agence %q : %w", name, err)
+		}
+		if _, exists := findHeaderProfile(headerProfiles, settings.HeaderProfile); settings.HeaderProfile != "" && !exists {
+			return fmt.Errorf("agence %q : profil d'en-têtes inconnu %q", name, settings.HeaderProfile)
+		}
+	}
+
+	if config.Proxies != nil {
+		if err := config.Proxies.Validate(); err != nil {
+			return err
+		}
+	}
+	if config.CircuitBreaker != nil {
+		if err := config.CircuitBreaker.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for name, schedule := range config.Schedules {
+		if _, exists := findAgency(name); !exists {
+			return fmt.Errorf("planification d'une agence inconnue : %q", name)
+		}
+		if err := schedule.Validate(); err != nil {
+			return fmt.Errorf("planification de l'agence %q : %w", name, err)
+		}
+	}
+	if config.DefaultSchedule != nil {
+		if err := config.DefaultSchedule.Validate(); err != nil {
+			return fmt.Errorf("defaultSchedule : %w", err)
+		}
+	}
+	if config.Timezone != "" {
+		if _, err := time.LoadLocation(config.Timezone); err != nil {
+			return fmt.Errorf("fuseau horaire inconnu : %q", config.Timezone)
+		}
+	}
+
+	for _, commune := range config.Communes {
+		if err := commune.Validate(); err != nil {
+			return fmt.Errorf("communes : %w", err)
+		}
+	}
+	// Les annonces d'une transaction sont synchronisées ensemble : deux blocs de même transaction se retireraient leurs annonces
+	transactions := make(map[TransactionType]bool)
+	for _, criteria := range config.searchCriteria() {
+		if err := criteria.Validate(config.Communes); err != nil {
+			return err
+		}
+		if transactions[criteria.transaction()] {
+			return fmt.Errorf("searches : plusieurs critères pour la transaction %s", criteria.transaction())
+		}
+		transactions[criteria.transaction()] = true
+	}
+	return nil
+}
+
+/**
+ * Profile retourne un profil de recherche par son nom.
+ * @param {string} name - Le nom du profil.
+ * @return {SearchProfile} - Le profil.
+ * @return {bool} - Faux si le profil n'existe pas.
+ */
+func (config *Config) Profile(name string) (SearchProfile, bool) {
+	for _, profile := range config.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return SearchProfile{}, false
+}
+
+/**
+ * Filter retourne le filtre des annonces correspondant au profil.
+ * @return {AnnouncementFilter} - Le filtre.
+ */
+func (profile SearchProfile) Filter() AnnouncementFilter {
+	filter := AnnouncementFilter{
+		Transaction: profile.Transaction,
+		MinPrice:    profile.MinPrice,
+		MaxPrice:    profile.MaxPrice,
+		MinSurface:  profile.MinSurface,
+		MaxSurface:  profile.MaxSurface,
+		City:        profile.City,
+	}
+	for _, name := range profile.Agencies {
+		if agency, exists := findAgency(string(name)); exists {
+			filter.Agencies = append(filter.Agencies, agency)
+		}
+	}
+	return filter
+}
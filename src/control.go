@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+ * ScraperControl permet de piloter le scraper depuis le dashboard : mise en pause d'agences et relance immédiate.
+ * @property {sync.Mutex} mu - Verrou protégeant l'état.
+ * @property {map[Agency]bool} paused - Agences en pause.
+ * @property {map[Agency]bool} rescans - Agences dont un nouveau scraping a été demandé.
+ * @property {chan struct{}} wake - Canal pour réveiller la boucle de scraping.
+ */
+type ScraperControl struct {
+	mu      sync.Mutex
+	paused  map[Agency]bool
+	rescans map[Agency]bool
+	wake    chan struct{}
+}
+
+/**
+ * NewScraperControl crée un contrôle de scraper sans agence en pause.
+ * @return {*ScraperControl} - Le contrôle.
+ */
+func NewScraperControl() *ScraperControl {
+	return &ScraperControl{
+		paused:  make(map[Agency]bool),
+		rescans: make(map[Agency]bool),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+/**
+ * SetPaused met en pause ou relance le scraping d'une agence.
+ * @param {Agency} agency - L'agence.
+ * @param {bool} paused - Vrai pour mettre en pause.
+ * @return {void}
+ */
+func (control *ScraperControl) SetPaused(agency Agency, paused bool) {
+	control.mu.Lock()
+	defer control.mu.Unlock()
+
+	if paused {
+		control.paused[agency] = true
+	} else {
+		delete(control.paused, agency)
+	}
+}
+
+/**
+ * IsPaused indique si le scraping d'une agence est en pause.
+ * @param {Agency} agency - L'agence.
+ * @return {bool} - Vrai si l'agence est en pause.
+ */
+func (control *ScraperControl) IsPaused(agency Agency) bool {
+	control.mu.Lock()
+	defer control.mu.Unlock()
+
+	return control.paused[agency]
+}
+
+/**
+ * PausedAgencies retourne les agences en pause, triées par nom.
+ * @return {[]Agency} - Les agences en pause.
+ */
+func (control *ScraperControl) PausedAgencies() []Agency {
+	control.mu.Lock()
+	defer control.mu.Unlock()
+
+	var agencies []Agency
+	for agency := range control.paused {
+		agencies = append(agencies, agency)
+	}
+	sort.Slice(agencies, func(i, j int) bool { return agencies[i] < agencies[j] })
+	return agencies
+}
+
+/**
+ * TriggerRescan demande un nouveau scraping immédiat d'une agence, sans attendre la fin de l'intervalle.
+ * @param {Agency} agency - L'agence à scraper.
+ * @return {void}
+ */
+func (control *ScraperControl) TriggerRescan(agency Agency) {
+	control.mu.Lock()
+	control.rescans[agency] = true
+	control.mu.Unlock()
+
+	control.Wake()
+}
+
+/**
+ * Wake réveille la boucle de scraping, par exemple à la fin du passage d'une agence.
+ * @return {void}
+ */
+func (control *ScraperControl) Wake() {
+	// Ne pas bloquer si un réveil est déjà en attente
+	select {
+	case control.wake <- struct{}{}:
+	default:
+	}
+}
+
+/**
+ * Wait attend la fin de l'intervalle, une demande de nouveau scraping ou un réveil.
+ * @param {time.Duration} interval - L'attente maximale.
+ * @return {map[Agency]bool} - Les agences à scraper en priorité, nil si l'intervalle est écoulé.
+ */
+func (control *ScraperControl) Wait(interval time.Duration) map[Agency]bool {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		control.mu.Lock()
+		control.rescans = make(map[Agency]bool)
+		control.mu.Unlock()
+		return nil
+	case <-control.wake:
+		control.mu.Lock()
+		defer control.mu.Unlock()
+		rescans := control.rescans
+		control.rescans = make(map[Agency]bool)
+		return rescans
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * CronExpression est une expression cron à cinq champs : minute, heure, jour du mois, mois, jour de la semaine.
+ * Chaque champ accepte *, une valeur, une plage (8-19), une liste (1,15) et un pas (*\/5, 8-18/2).
+ * Le dimanche vaut 0 ou 7.
+ * @property {string} source - L'expression d'origine.
+ * @property {[]bool} minutes - Les minutes autorisées, indexées de 0 à 59.
+ * @property {[]bool} hours - Les heures autorisées, indexées de 0 à 23.
+ * @property {[]bool} days - Les jours du mois autorisés, indexés de 1 à 31.
+ * @property {[]bool} months - Les mois autorisés, indexés de 1 à 12.
+ * @property {[]bool} weekdays - Les jours de la semaine autorisés, indexés de 0 (dimanche) à 6.
+ * @property {bool} anyDay - Vrai si le jour du mois est *.
+ * @property {bool} anyWeekday - Vrai si le jour de la semaine est *.
+ */
+type CronExpression struct {
+	source     string
+	minutes    []bool
+	hours      []bool
+	days       []bool
+	months     []bool
+	weekdays   []bool
+	anyDay     bool
+	anyWeekday bool
+}
+
+/**
+ * ParseCron lit une expression cron à cinq champs.
+ * @param {string} expression - L'expression (ex: "*\/5 8-19 * * 1-5").
+ * @return {*CronExpression} - L'expression lue.
+ * @return {error} - Erreur si l'expression est invalide.
+ */
+func ParseCron(expression string) (*CronExpression, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expression cron %q : 5 champs attendus (minute heure jour mois jour-de-semaine)", expression)
+	}
+
+	cron := &CronExpression{source: expression, anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	var err error
+	if cron.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("expression cron %q, minutes : %w", expression, err)
+	}
+	if cron.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("expression cron %q, heures : %w", expression, err)
+	}
+	if cron.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("expression cron %q, jours du mois : %w", expression, err)
+	}
+	if cron.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("expression cron %q, mois : %w", expression, err)
+	}
+	weekdays, err := parseCronField(fields[4], 0, 7)
+	if err != nil {
+		return nil, fmt.Errorf("expression cron %q, jours de la semaine : %w", expression, err)
+	}
+	// Le dimanche peut s'écrire 0 ou 7
+	weekdays[0] = weekdays[0] || weekdays[7]
+	cron.weekdays = weekdays[:7]
+
+	return cron, nil
+}
+
+/**
+ * parseCronField lit un champ d'une expression cron.
+ * @param {string} field - Le champ.
+ * @param {int} low - La plus petite valeur du champ.
+ * @param {int} high - La plus grande valeur du champ.
+ * @return {[]bool} - Les valeurs autorisées, indexées de 0 à high.
+ * @return {error} - Erreur si le champ est invalide.
+ */
+func parseCronField(field string, low int, high int) ([]bool, error) {
+	allowed := make([]bool, high+1)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			parsed, err := strconv.Atoi(stepPart)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("pas invalide %q", part)
+			}
+			step = parsed
+		}
+
+		start, end := low, high
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("valeur invalide %q", part)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("valeur invalide %q", part)
+				}
+			} else if hasStep {
+				// "5/15" : de 5 jusqu'à la fin du champ, toutes les 15 unités
+				end = high
+			}
+		}
+		if start < low || end > high || start > end {
+			return nil, fmt.Errorf("valeur hors limites %q (%d-%d)", part, low, high)
+		}
+
+		for value := start; value <= end; value += step {
+			allowed[value] = true
+		}
+	}
+	return allowed, nil
+}
+
+/**
+ * String retourne l'expression d'origine.
+ * @return {string} - L'expression.
+ */
+func (cron *CronExpression) String() string {
+	return cron.source
+}
+
+/**
+ * matchesDay indique si un jour correspond à l'expression. Comme dans cron, si le jour du mois et le jour
+ * de la semaine sont tous deux restreints, il suffit que l'un des deux corresponde.
+ * @param {time.Time} t - Le jour.
+ * @return {bool} - Vrai si le jour correspond.
+ */
+func (cron *CronExpression) matchesDay(t time.Time) bool {
+	day, weekday := cron.days[t.Day()], cron.weekdays[t.Weekday()]
+	switch {
+	case cron.anyDay && cron.anyWeekday:
+		return true
+	case cron.anyDay:
+		return weekday
+	case cron.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+/**
+ * Next retourne la première date correspondant à l'expression, strictement après une date, à la minute près.
+ * @param {time.Time} after - La date de départ.
+ * @return {time.Time} - La prochaine date, zéro si aucune date ne correspond dans les cinq prochaines années.
+ */
+func (cron *CronExpression) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !cron.months[t.Month()]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !cron.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !cron.hours[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !cron.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
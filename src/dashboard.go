@@ -0,0 +1,314 @@
+package main
+
+import (
+	"crypto/subtle"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Templates et fichiers statiques du dashboard, embarqués dans le binaire
+var (
+	//go:embed web/templates/*.html
+	dashboardTemplatesFS embed.FS
+
+	//go:embed web/static
+	dashboardStaticFS embed.FS
+)
+
+// Fonctions disponibles dans les templates du dashboard
+var dashboardFuncs = template.FuncMap{
+	"formatPrice": formatPrice,
+	"formatTime": func(date time.Time) string {
+		if date.IsZero() {
+			return "-"
+		}
+		return date.Local().Format("02/01/2006 15:04")
+	},
+	"pathEscape": url.PathEscape,
+}
+
+// Templates des pages du dashboard, chacune combinée avec le layout commun
+var dashboardTemplates = parseDashboardTemplates("announcements", "announcement", "agencies", "map")
+
+/**
+ * agencyStatus est l'état d'une agence affiché sur le dashboard.
+ */
+type agencyStatus struct {
+	Agency Agency
+	Health AgencyHealth
+	Paused bool
+}
+
+/**
+ * parseDashboardTemplates charge les templates des pages du dashboard.
+ * @param {...string} pages - Les noms des pages (fichiers web/templates/<page>.html).
+ * @return {map[string]*template.Template} - Les templates indexés par nom de page.
+ */
+func parseDashboardTemplates(pages ...string) map[string]*template.Template {
+	templates := make(map[string]*template.Template)
+	for _, page := range pages {
+		templates[page] = template.Must(template.New("layout.html").Funcs(dashboardFuncs).ParseFS(
+			dashboardTemplatesFS,
+			"web/templates/layout.html",
+			"web/templates/"+page+".html",
+		))
+	}
+	return templates
+}
+
+/**
+ * registerDashboardRoutes enregistre les routes du dashboard sur le routeur.
+ * @param {*http.ServeMux} mux - Le routeur.
+ * @return {void}
+ */
+func (api *APIServer) registerDashboardRoutes(mux *http.ServeMux) {
+	static, err := fs.Sub(dashboardStaticFS, "web/static")
+	if err != nil {
+		log.Fatalf("Erreur lors du chargement des fichiers statiques du dashboard : %v", err)
+	}
+
+	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServerFS(static)))
+	mux.Handle("GET /{$}", http.RedirectHandler("/dashboard", http.StatusFound))
+	mux.HandleFunc("GET /dashboard", api.handleDashboardAnnouncements)
+	mux.HandleFunc("GET /dashboard/announcements/{agency}/{reference...}", api.handleDashboardAnnouncement)
+	mux.HandleFunc("GET /dashboard/agencies", api.handleDashboardAgencies)
+	mux.HandleFunc("GET /dashboard/map", api.handleDashboardMap)
+	mux.HandleFunc("POST /dashboard/agencies/{agency}/pause", api.handleDashboardPause)
+	mux.HandleFunc("POST /dashboard/agencies/{agency}/resume", api.handleDashboardResume)
+	mux.HandleFunc("POST /dashboard/agencies/{agency}/rescan", api.handleDashboardRescan)
+}
+
+/**
+ * handleDashboardAnnouncements affiche les dernières annonces dans un tableau filtrable.
+ * Les filtres sont les mêmes que ceux de GET /announcements.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleDashboardAnnouncements(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, err := parseAnnouncementFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sortBy := query.Get("sort")
+	if !isValidSortField(sortBy) {
+		http.Error(w, fmt.Sprintf("tri inconnu : %s", sortBy), http.StatusBadRequest)
+		return
+	}
+
+	announcements := api.store.Query(filter, sortBy)
+	total := len(announcements)
+	if len(announcements) > MaxPerPage {
+		announcements = announcements[:MaxPerPage]
+	}
+
+	renderDashboard(w, "announcements", map[string]any{
+		"Title":         "Annonces",
+		"Agencies":      AllAgencies,
+		"Query":         query,
+		"Announcements": announcements,
+		"Total":         total,
+	})
+}
+
+/**
+ * handleDashboardAnnouncement affiche une annonce avec la chronologie de son prix et de son statut.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleDashboardAnnouncement(w http.ResponseWriter, r *http.Request) {
+	agency, exists := findAgency(r.PathValue("agency"))
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	announcement, exists := api.store.Get(agency, TransactionType(r.URL.Query().Get("transaction")), r.PathValue("reference"))
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	renderDashboard(w, "announcement", map[string]any{
+		"Title":        fmt.Sprintf("%s - %s", announcement.Agency, announcement.Reference),
+		"Announcement": announcement,
+	})
+}
+
+/**
+ * handleDashboardAgencies affiche l'état de chaque agence (dernier succès, compteurs, erreurs, pause).
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} _ - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleDashboardAgencies(w http.ResponseWriter, _ *http.Request) {
+	healthByAgency := make(map[Agency]AgencyHealth)
+	for _, health := range api.store.Health() {
+		healthByAgency[health.Agency] = health
+	}
+
+	var statuses []agencyStatus
+	for _, agency := range AllAgencies {
+		statuses = append(statuses, agencyStatus{
+			Agency: agency,
+			Health: healthByAgency[agency],
+			Paused: api.control.IsPaused(agency),
+		})
+	}
+
+	renderDashboard(w, "agencies", map[string]any{
+		"Title":    "Agences",
+		"Statuses": statuses,
+	})
+}
+
+/**
+ * handleDashboardMap affiche les annonces localisées sur une carte.
+ * La carte charge GET /announcements.geojson avec les filtres de la page.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleDashboardMap(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("status") == "" {
+		query.Set("status", string(StatusActive))
+	}
+
+	renderDashboard(w, "map", map[string]any{
+		"Title":      "Carte",
+		"Agencies":   AllAgencies,
+		"Query":      query,
+		"GeoJSONURL": "/announcements.geojson?" + query.Encode(),
+	})
+}
+
+/**
+ * handleDashboardPause met en pause le scraping d'une agence.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleDashboardPause(w http.ResponseWriter, r *http.Request) {
+	api.handleDashboardAction(w, r, func(agency Agency) {
+		api.control.SetPaused(agency, true)
+		log.Printf("Scraping de l'agence %s mis en pause depuis le dashboard", agency)
+	})
+}
+
+/**
+ * handleDashboardResume relance le scraping d'une agence en pause.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleDashboardResume(w http.ResponseWriter, r *http.Request) {
+	api.handleDashboardAction(w, r, func(agency Agency) {
+		api.control.SetPaused(agency, false)
+		log.Printf("Scraping de l'agence %s relancé depuis le dashboard", agency)
+	})
+}
+
+/**
+ * handleDashboardRescan demande un nouveau scraping immédiat d'une agence.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleDashboardRescan(w http.ResponseWriter, r *http.Request) {
+	api.handleDashboardAction(w, r, func(agency Agency) {
+		api.control.TriggerRescan(agency)
+		log.Printf("Nouveau scraping de l'agence %s demandé depuis le dashboard", agency)
+	})
+}
+
+/**
+ * handleDashboardAction applique une action à l'agence de l'URL puis revient à la page des agences.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @param {func(Agency)} action - L'action à appliquer.
+ * @return {void}
+ */
+func (api *APIServer) handleDashboardAction(w http.ResponseWriter, r *http.Request, action func(Agency)) {
+	if !isSameOrigin(r) {
+		http.Error(w, "requête d'une autre origine refusée", http.StatusForbidden)
+		return
+	}
+	if !api.isDashboardAdmin(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="agency-scraper", charset="UTF-8"`)
+		http.Error(w, "authentification requise", http.StatusUnauthorized)
+		return
+	}
+
+	agency, exists := findAgency(r.PathValue("agency"))
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	action(agency)
+	http.Redirect(w, r, "/dashboard/agencies", http.StatusSeeOther)
+}
+
+/**
+ * isSameOrigin indique si une requête vient d'une page servie par le scraper, d'après son en-tête Origin ou Referer.
+ * Protège les actions du dashboard contre les formulaires d'autres sites (CSRF).
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {bool} - Faux si l'origine est une autre adresse ou est absente.
+ */
+func isSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		origin = r.Header.Get("Referer")
+	}
+	parsed, err := url.Parse(origin)
+	if origin == "" || err != nil {
+		return false
+	}
+	return parsed.Host == r.Host
+}
+
+/**
+ * isDashboardAdmin indique si une requête peut modifier l'état du scraper : mot de passe du dashboard (authentification
+ * HTTP Basic) s'il est configuré, sinon requête locale uniquement.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {bool} - Vrai si la requête est autorisée.
+ */
+func (api *APIServer) isDashboardAdmin(r *http.Request) bool {
+	if password := api.config.Get().DashboardPassword; password != "" {
+		_, given, ok := r.BasicAuth()
+		return ok && subtle.ConstantTimeCompare([]byte(given), []byte(password)) == 1
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+/**
+ * renderDashboard affiche une page du dashboard.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {string} page - Le nom de la page.
+ * @param {map[string]any} data - Les données de la page.
+ * @return {void}
+ */
+func renderDashboard(w http.ResponseWriter, page string, data map[string]any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplates[page].Execute(w, data); err != nil {
+		log.Printf("Erreur lors de l'affichage de la page %s du dashboard : %v", page, err)
+	}
+}
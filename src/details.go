@@ -0,0 +1,294 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Expressions régulières pour extraire les caractéristiques d'une annonce depuis le texte de la page
+var (
+	pricePattern      = regexp.MustCompile(`(\d{1,3}(?:[\s\x{00a0}\x{202f}.]\d{3})+|\d+)(?:,(\d{1,2}))?\s*(?:€|euros?)`)
+	surfacePattern    = regexp.MustCompile(`(?i)(\d+(?:[,.]\d+)?)\s*m(?:²|2)(?:\W|$)`)
+	roomsPattern      = regexp.MustCompile(`(?i)(\d+)\s*pi[eè]ces?|\b[TF](\d)\b`)
+	cityAfterPattern  = regexp.MustCompile(`\b(\d{5})\s+([A-ZÀ-Ý][A-Za-zÀ-ÿ']+(?:-[A-Za-zÀ-ÿ']+)*)`)
+	cityBeforePattern = regexp.MustCompile(`([A-ZÀ-Ý][A-Za-zÀ-ÿ']+(?:-[A-Za-zÀ-ÿ']+)*)\s*\(?(\d{5})\)?`)
+
+	// Champs des annonces de vente : honoraires, charges et lots de la copropriété, DPE
+	agencyFeesPattern  = regexp.MustCompile(`(?i)honoraires[^0-9€%.]{0,80}?(\d{1,3}(?:[\s\x{00a0}\x{202f}.]\d{3})+|\d+(?:,\d+)?)\s*(€|euros?|%)`)
+	chargesPattern     = regexp.MustCompile(`(?i)(?:charges\s+(?:annuelles\s+)?(?:de\s+)?copropri[ée]t[ée]|quote-part\s+(?:annuelle\s+)?de\s+charges|charges\s+courantes\s+annuelles)[^0-9€]{0,60}?(\d{1,3}(?:[\s\x{00a0}\x{202f}.]\d{3})+|\d+)(?:,\d{1,2})?\s*(?:€|euros?)`)
+	lotsPattern        = regexp.MustCompile(`(?i)nombre\s+de\s+lots\s*:?\s*(\d+)|(\d+)\s+lots\b`)
+	energyClassPattern = regexp.MustCompile(`(?i:\bDPE|classe\s+[ée]nerg(?:ie|[ée]tique)|[ée]tiquette\s+[ée]nergie)\s*[(:-]?\s*(?i:classe\s+)?([A-G])\b`)
+)
+
+/**
+ * setupDetailPageEnrichment configure le collecteur pour extraire les caractéristiques communes
+ * (titre, prix, surface, pièces, ville, photo, coordonnées, honoraires, copropriété, DPE) de chaque page de détail,
+ * quelle que soit l'agence.
+ * Les balises Open Graph sont privilégiées, le texte de la page sert de repli.
+ * @param {colly.Collector} collector - Le collecteur à configurer.
+ * @param {map[string]Announcement} details - Les caractéristiques trouvées, indexées par URL de la page.
+ * @return {void}
+ */
+func setupDetailPageEnrichment(collector *colly.Collector, details map[string]Announcement) {
+	collector.OnHTML("html", func(page *colly.HTMLElement) {
+		title := strings.TrimSpace(page.ChildAttr("meta[property='og:title']", "content"))
+		if title == "" {
+			title = strings.TrimSpace(page.ChildText("title"))
+		}
+		description := strings.TrimSpace(page.ChildAttr("meta[property='og:description']", "content"))
+		if description == "" {
+			description = strings.TrimSpace(page.ChildAttr("meta[name='description']", "content"))
+		}
+		body := strings.Join(strings.Fields(page.ChildText("body")), " ")
+
+		// Les métadonnées sont plus fiables que le texte de la page, qui contient aussi les annonces similaires
+		summary := title + " " + description
+
+		announcement := Announcement{title: title}
+		if photo := page.ChildAttr("meta[property='og:image']", "content"); photo != "" {
+			announcement.photo = page.Request.AbsoluteURL(photo)
+		}
+		if amount := page.ChildAttr("meta[property='product:price:amount']", "content"); amount != "" {
+			announcement.price = parseFrenchNumber(amount)
+		}
+		if announcement.price == 0 {
+			announcement.price = firstPrice(summary, body)
+		}
+		announcement.surface = firstSurface(summary, body)
+		announcement.rooms = firstRooms(summary, body)
+		announcement.city = firstCity(summary, body)
+		announcement.latitude, announcement.longitude, _ = extractCoordinates(page)
+		announcement.agencyFees = firstAgencyFees(announcement.price, summary, body)
+		announcement.coOwnershipCharges = firstCoOwnershipCharges(summary, body)
+		announcement.lots = firstLots(summary, body)
+		announcement.energyClass = firstEnergyClass(summary, body)
+
+		details[requestURL(page.Request)] = announcement
+	})
+}
+
+/**
+ * mergeAnnouncementDetails complète les annonces avec les caractéristiques extraites de leur page de détail.
+ * Les valeurs déjà renseignées par l'agence sont conservées.
+ * @param {[]Announcement} announcements - Les annonces à compléter.
+ * @param {map[string]Announcement} details - Les caractéristiques trouvées, indexées par URL de la page.
+ * @return {void}
+ */
+func mergeAnnouncementDetails(announcements []Announcement, details map[string]Announcement) {
+	for i := range announcements {
+		detail, exists := details[announcements[i].url]
+		if !exists {
+			continue
+		}
+
+		announcement := &announcements[i]
+		if announcement.title == "" {
+			announcement.title = detail.title
+		}
+		if announcement.price == 0 {
+			announcement.price = detail.price
+		}
+		if announcement.surface == 0 {
+			announcement.surface = detail.surface
+		}
+		if announcement.rooms == 0 {
+			announcement.rooms = detail.rooms
+		}
+		if announcement.city == "" {
+			announcement.city = detail.city
+		}
+		if announcement.photo == "" {
+			announcement.photo = detail.photo
+		}
+		if announcement.latitude == 0 && announcement.longitude == 0 {
+			announcement.latitude = detail.latitude
+			announcement.longitude = detail.longitude
+		}
+		if announcement.agencyFees == 0 {
+			announcement.agencyFees = detail.agencyFees
+		}
+		if announcement.coOwnershipCharges == 0 {
+			announcement.coOwnershipCharges = detail.coOwnershipCharges
+		}
+		if announcement.lots == 0 {
+			announcement.lots = detail.lots
+		}
+		if announcement.energyClass == "" {
+			announcement.energyClass = detail.energyClass
+		}
+	}
+}
+
+/**
+ * firstPrice retourne le premier prix trouvé dans les textes, dans l'ordre.
+ * @param {...string} texts - Les textes à analyser.
+ * @return {float64} - Le prix en euros, 0 si introuvable.
+ */
+func firstPrice(texts ...string) float64 {
+	for _, text := range texts {
+		if match := pricePattern.FindStringSubmatch(text); match != nil {
+			price := parseFrenchNumber(match[1])
+			if match[2] != "" {
+				price += parseFrenchNumber(match[2]) / 100
+			}
+			if price > 0 {
+				return price
+			}
+		}
+	}
+	return 0
+}
+
+/**
+ * firstSurface retourne la première surface trouvée dans les textes, dans l'ordre.
+ * @param {...string} texts - Les textes à analyser.
+ * @return {float64} - La surface en m², 0 si introuvable.
+ */
+func firstSurface(texts ...string) float64 {
+	for _, text := range texts {
+		if match := surfacePattern.FindStringSubmatch(text); match != nil {
+			return parseFrenchNumber(match[1])
+		}
+	}
+	return 0
+}
+
+/**
+ * firstRooms retourne le premier nombre de pièces trouvé dans les textes, dans l'ordre.
+ * @param {...string} texts - Les textes à analyser.
+ * @return {int} - Le nombre de pièces, 0 si introuvable.
+ */
+func firstRooms(texts ...string) int {
+	for _, text := range texts {
+		if match := roomsPattern.FindStringSubmatch(text); match != nil {
+			value := match[1]
+			if value == "" {
+				value = match[2]
+			}
+			rooms, _ := strconv.Atoi(value)
+			return rooms
+		}
+	}
+	return 0
+}
+
+/**
+ * firstCity retourne la première ville trouvée à côté d'un code postal dans les textes, dans l'ordre.
+ * @param {...string} texts - Les textes à analyser.
+ * @return {string} - La ville suivie de son code postal, vide si introuvable.
+ */
+func firstCity(texts ...string) string {
+	for _, text := range texts {
+		if match := cityAfterPattern.FindStringSubmatch(text); match != nil {
+			return match[2] + " (" + match[1] + ")"
+		}
+		if match := cityBeforePattern.FindStringSubmatch(text); match != nil {
+			return match[1] + " (" + match[2] + ")"
+		}
+	}
+	return ""
+}
+
+/**
+ * firstAgencyFees retourne les premiers honoraires d'agence trouvés dans les textes, dans l'ordre.
+ * Des honoraires en pourcentage sont convertis en euros : ils portent sur le prix hors honoraires,
+ * inclus dans le prix affiché.
+ * @param {float64} price - Le prix affiché, honoraires inclus.
+ * @param {...string} texts - Les textes à analyser.
+ * @return {float64} - Les honoraires en euros, 0 si introuvables.
+ */
+func firstAgencyFees(price float64, texts ...string) float64 {
+	for _, text := range texts {
+		for _, match := range agencyFeesPattern.FindAllStringSubmatch(text, -1) {
+			amount := parseFrenchNumber(match[1])
+			if match[2] != "%" {
+				if amount > 0 {
+					return amount
+				}
+				continue
+			}
+			if price > 0 && amount > 0 && amount < 100 {
+				return math.Round(price * amount / (100 + amount))
+			}
+		}
+	}
+	return 0
+}
+
+/**
+ * firstCoOwnershipCharges retourne les premières charges de copropriété annuelles trouvées dans les textes, dans l'ordre.
+ * @param {...string} texts - Les textes à analyser.
+ * @return {float64} - Les charges en euros par an, 0 si introuvables.
+ */
+func firstCoOwnershipCharges(texts ...string) float64 {
+	for _, text := range texts {
+		if match := chargesPattern.FindStringSubmatch(text); match != nil {
+			return parseFrenchNumber(match[1])
+		}
+	}
+	return 0
+}
+
+/**
+ * firstLots retourne le premier nombre de lots de copropriété trouvé dans les textes, dans l'ordre.
+ * @param {...string} texts - Les textes à analyser.
+ * @return {int} - Le nombre de lots, 0 si introuvable.
+ */
+func firstLots(texts ...string) int {
+	for _, text := range texts {
+		if match := lotsPattern.FindStringSubmatch(text); match != nil {
+			value := match[1]
+			if value == "" {
+				value = match[2]
+			}
+			lots, _ := strconv.Atoi(value)
+			return lots
+		}
+	}
+	return 0
+}
+
+/**
+ * firstEnergyClass retourne la première classe énergie du DPE trouvée dans les textes, dans l'ordre.
+ * @param {...string} texts - Les textes à analyser.
+ * @return {string} - La classe, de A à G, vide si introuvable.
+ */
+func firstEnergyClass(texts ...string) string {
+	for _, text := range texts {
+		if match := energyClassPattern.FindStringSubmatch(text); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+/**
+ * parseFrenchNumber convertit un nombre écrit à la française ("1 250,50", "1.250") en float64.
+ * @param {string} value - Le nombre à convertir.
+ * @return {float64} - La valeur, 0 si la conversion échoue.
+ */
+func parseFrenchNumber(value string) float64 {
+	value = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\u00a0', '\u202f':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(value))
+
+	// Un point suivi de trois chiffres est un séparateur de milliers, sinon c'est la décimale
+	if dot := strings.LastIndex(value, "."); dot != -1 && len(value)-dot-1 == 3 && !strings.Contains(value, ",") {
+		value = strings.ReplaceAll(value, ".", "")
+	}
+	value = strings.ReplaceAll(value, ",", ".")
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+/**
+ * ExportFormat est un format d'export des annonces.
+ */
+type ExportFormat string
+
+/**
+ * Constantes pour les formats d'export.
+ */
+const (
+	ExportCSV     ExportFormat = "csv"     // Pour les tableurs
+	ExportNDJSON  ExportFormat = "ndjson"  // JSON Lines, une annonce par ligne, historique compris
+	ExportParquet ExportFormat = "parquet" // Pour les notebooks d'analyse
+)
+
+// En-têtes des colonnes des exports CSV, dans l'ordre des champs de exportRow
+var exportCSVHeader = []string{
+	"agency", "transaction", "reference", "url", "title", "price", "agency_fees", "co_ownership_charges", "lots", "energy_class",
+	"surface", "rooms", "city", "photo",
+	"latitude", "longitude", "status", "first_seen", "last_seen", "removed_at", "notified",
+}
+
+/**
+ * exportRow est une annonce à plat, sans historique, pour les exports CSV et Parquet.
+ */
+type exportRow struct {
+	Agency             string     `parquet:"agency"`
+	Transaction        string     `parquet:"transaction"`
+	Reference          string     `parquet:"reference"`
+	URL                string     `parquet:"url"`
+	Title              string     `parquet:"title"`
+	Price              float64    `parquet:"price"`
+	AgencyFees         float64    `parquet:"agency_fees"`
+	CoOwnershipCharges float64    `parquet:"co_ownership_charges"`
+	Lots               int64      `parquet:"lots"`
+	EnergyClass        string     `parquet:"energy_class"`
+	Surface            float64    `parquet:"surface"`
+	Rooms              int64      `parquet:"rooms"`
+	City               string     `parquet:"city"`
+	Photo              string     `parquet:"photo"`
+	Latitude           float64    `parquet:"latitude"`
+	Longitude          float64    `parquet:"longitude"`
+	Status             string     `parquet:"status"`
+	FirstSeen          time.Time  `parquet:"first_seen"`
+	LastSeen           time.Time  `parquet:"last_seen"`
+	RemovedAt          *time.Time `parquet:"removed_at,optional"`
+	Notified           bool       `parquet:"notified"`
+}
+
+/**
+ * parseExportFormat lit un format d'export ("jsonl" est accepté pour "ndjson").
+ * @param {string} value - Le format demandé.
+ * @return {ExportFormat} - Le format.
+ * @return {error} - Erreur si le format est inconnu.
+ */
+func parseExportFormat(value string) (ExportFormat, error) {
+	switch format := ExportFormat(strings.ToLower(value)); format {
+	case ExportCSV, ExportNDJSON, ExportParquet:
+		return format, nil
+	case "jsonl":
+		return ExportNDJSON, nil
+	}
+	return "", fmt.Errorf("format d'export inconnu : %s (csv, ndjson ou parquet)", value)
+}
+
+/**
+ * ContentType retourne le type de contenu HTTP du format.
+ * @return {string} - Le type de contenu.
+ */
+func (format ExportFormat) ContentType() string {
+	switch format {
+	case ExportCSV:
+		return "text/csv; charset=utf-8"
+	case ExportNDJSON:
+		return "application/x-ndjson"
+	}
+	return "application/vnd.apache.parquet"
+}
+
+/**
+ * ExportAnnouncements écrit les annonces dans le format demandé.
+ * @param {io.Writer} w - La destination.
+ * @param {ExportFormat} format - Le format d'export.
+ * @param {[]StoredAnnouncement} announcements - Les annonces à exporter.
+ * @return {error} - Erreur d'écriture.
+ */
+func ExportAnnouncements(w io.Writer, format ExportFormat, announcements []StoredAnnouncement) error {
+	switch format {
+	case ExportCSV:
+		return exportCSV(w, announcements)
+	case ExportNDJSON:
+		return exportNDJSON(w, announcements)
+	case ExportParquet:
+		return exportParquet(w, announcements)
+	}
+	return fmt.Errorf("format d'export inconnu : %s", format)
+}
+
+/**
+ * exportCSV écrit les annonces en CSV, une ligne par annonce.
+ * @param {io.Writer} w - La destination.
+ * @param {[]StoredAnnouncement} announcements - Les annonces à exporter.
+ * @return {error} - Erreur d'écriture.
+ */
+func exportCSV(w io.Writer, announcements []StoredAnnouncement) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportCSVHeader); err != nil {
+		return err
+	}
+
+	for _, announcement := range announcements {
+		row := newExportRow(announcement)
+		removedAt := ""
+		if row.RemovedAt != nil {
+			removedAt = row.RemovedAt.Format(time.RFC3339)
+		}
+
+		err := writer.Write([]string{
+			row.Agency,
+			row.Transaction,
+			row.Reference,
+			row.URL,
+			row.Title,
+			strconv.FormatFloat(row.Price, 'f', -1, 64),
+			strconv.FormatFloat(row.AgencyFees, 'f', -1, 64),
+			strconv.FormatFloat(row.CoOwnershipCharges, 'f', -1, 64),
+			strconv.FormatInt(row.Lots, 10),
+			row.EnergyClass,
+			strconv.FormatFloat(row.Surface, 'f', -1, 64),
+			strconv.FormatInt(row.Rooms, 10),
+			row.City,
+			row.Photo,
+			strconv.FormatFloat(row.Latitude, 'f', -1, 64),
+			strconv.FormatFloat(row.Longitude, 'f', -1, 64),
+			row.Status,
+			row.FirstSeen.Format(time.RFC3339),
+			row.LastSeen.Format(time.RFC3339),
+			removedAt,
+			strconv.FormatBool(row.Notified),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+/**
+ * exportNDJSON écrit les annonces en JSON Lines, historique compris.
+ * @param {io.Writer} w - La destination.
+ * @param {[]StoredAnnouncement} announcements - Les annonces à exporter.
+ * @return {error} - Erreur d'écriture.
+ */
+func exportNDJSON(w io.Writer, announcements []StoredAnnouncement) error {
+	encoder := json.NewEncoder(w)
+	for _, announcement := range announcements {
+		if err := encoder.Encode(announcement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * exportParquet écrit les annonces dans un fichier Parquet.
+ * @param {io.Writer} w - La destination.
+ * @param {[]StoredAnnouncement} announcements - Les annonces à exporter.
+ * @return {error} - Erreur d'écriture.
+ */
+func exportParquet(w io.Writer, announcements []StoredAnnouncement) error {
+	rows := make([]exportRow, 0, len(announcements))
+	for _, announcement := range announcements {
+		rows = append(rows, newExportRow(announcement))
+	}
+
+	writer := parquet.NewGenericWriter[exportRow](w)
+	if _, err := writer.Write(rows); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+/**
+ * newExportRow convertit une annonce stockée en ligne d'export.
+ * @param {StoredAnnouncement} announcement - L'annonce.
+ * @return {exportRow} - La ligne d'export.
+ */
+func newExportRow(announcement StoredAnnouncement) exportRow {
+	return exportRow{
+		Agency:             string(announcement.Agency),
+		Transaction:        string(announcement.Transaction),
+		Reference:          announcement.Reference,
+		URL:                announcement.URL,
+		Title:              announcement.Title,
+		Price:              announcement.Price,
+		AgencyFees:         announcement.AgencyFees,
+		CoOwnershipCharges: announcement.CoOwnershipCharges,
+		Lots:               int64(announcement.Lots),
+		EnergyClass:        announcement.EnergyClass,
+		Surface:            announcement.Surface,
+		Rooms:              int64(announcement.Rooms),
+		City:               announcement.City,
+		Photo:              announcement.Photo,
+		Latitude:           announcement.Latitude,
+		Longitude:          announcement.Longitude,
+		Status:             string(announcement.Status),
+		FirstSeen:          announcement.FirstSeen,
+		LastSeen:           announcement.LastSeen,
+		RemovedAt:          announcement.RemovedAt,
+		Notified:           announcement.Notified,
+	}
+}
+
+/**
+ * runExportCommand exécute la commande "export" de la ligne de commande.
+ * Exemple : agency-scraper export --format csv --from 2024-01-01 --agency Foncia --output annonces.csv
+ * @param {[]string} args - Les arguments de la commande (sans "export").
+ * @return {error} - Erreur de lecture du store, de filtre ou d'écriture.
+ */
+func runExportCommand(args []string) error {
+	var formatName, output, storePath, from, to, status, transaction string
+	var agencies stringList
+
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.StringVar(&formatName, "format", "csv", "Format d'export : csv, ndjson ou parquet")
+	flags.StringVar(&output, "output", "", "Fichier de sortie (sortie standard si vide)")
+	flags.StringVar(&storePath, "store", "data/store.json", "Fichier JSON du store à exporter")
+	flags.StringVar(&from, "from", "", "Annonces vues pour la première fois à partir de cette date (AAAA-MM-JJ ou RFC 3339)")
+	flags.StringVar(&to, "to", "", "Annonces vues pour la première fois avant cette date (AAAA-MM-JJ ou RFC 3339)")
+	flags.StringVar(&status, "status", "", "Statut des annonces : active ou removed")
+	flags.StringVar(&transaction, "transaction", "", "Transaction des annonces : location ou vente")
+	flags.Var(&agencies, "agency", "Agence à exporter (répétable)")
+	flags.Parse(args)
+
+	format, err := parseExportFormat(formatName)
+	if err != nil {
+		return err
+	}
+
+	// Les filtres sont les mêmes que ceux de l'API
+	query := url.Values{
+		"agency":          agencies,
+		"status":          {status},
+		"transaction":     {transaction},
+		"first_seen_from": {from},
+		"first_seen_to":   {to},
+	}
+	filter, err := parseAnnouncementFilter(query)
+	if err != nil {
+		return err
+	}
+
+	// Le store est lu sans être réécrit : le scraper peut l'écrire en même temps
+	store, err := ReadStore(storePath)
+	if err != nil {
+		return err
+	}
+	announcements := store.Query(filter, "first_seen")
+
+	if output == "" {
+		if err := ExportAnnouncements(os.Stdout, format, announcements); err != nil {
+			return fmt.Errorf("export des annonces : %w", err)
+		}
+	} else {
+		file, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("création du fichier d'export : %w", err)
+		}
+		if err := ExportAnnouncements(file, format, announcements); err != nil {
+			file.Close()
+			return fmt.Errorf("export des annonces : %w", err)
+		}
+		// Une erreur à la fermeture signifie que le fichier est incomplet
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("écriture du fichier d'export : %w", err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d annonce(s) exportée(s) au format %s.\n", len(announcements), format)
+	return nil
+}
+
+/**
+ * stringList est une option de ligne de commande répétable.
+ */
+type stringList []string
+
+/**
+ * String retourne les valeurs séparées par des virgules.
+ * @return {string} - Les valeurs.
+ */
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+/**
+ * Set ajoute une valeur à la liste.
+ * @param {string} value - La valeur.
+ * @return {error} - Toujours nil.
+ */
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+/**
+ * handleExport gère GET /export : export des annonces avec les mêmes filtres que GET /announcements.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	formatName := query.Get("format")
+	if formatName == "" {
+		formatName = string(ExportCSV)
+	}
+	format, err := parseExportFormat(formatName)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, err := parseAnnouncementFilter(query)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	announcements := api.store.Query(filter, "first_seen")
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"annonces-%s.%s\"", time.Now().Format("20060102-150405"), format))
+	if err := ExportAnnouncements(w, format, announcements); err != nil {
+		log.Printf("Erreur lors de l'export des annonces : %v", err)
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Nombre maximal d'annonces publiées dans un flux
+const FeedMaxItems = 100
+
+/**
+ * atomFeed est un flux Atom (RFC 4287).
+ */
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+/**
+ * atomLink est un lien d'un flux ou d'une entrée Atom.
+ */
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+/**
+ * atomEntry est une entrée d'un flux Atom.
+ */
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Author    atomAuthor `xml:"author"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary"`
+}
+
+/**
+ * atomAuthor est l'auteur d'une entrée Atom (l'agence).
+ */
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+/**
+ * rssFeed est un flux RSS 2.0.
+ */
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+/**
+ * rssChannel est le canal d'un flux RSS.
+ */
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+/**
+ * rssItem est un élément d'un flux RSS.
+ */
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Description string        `xml:"description"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+/**
+ * rssGUID est l'identifiant unique d'un élément RSS.
+ */
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+/**
+ * rssEnclosure est la photo jointe à un élément RSS.
+ */
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+/**
+ * handleAllFeed gère GET /feeds/all.atom : toutes les annonces, toutes agences confondues.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleAllFeed(w http.ResponseWriter, r *http.Request) {
+	announcements := api.store.Query(AnnouncementFilter{}, "-first_seen")
+	writeAtomFeed(w, r, "Annonces immobilières", announcements)
+}
+
+/**
+ * handleAgencyFeed gère GET /feeds/agency/{agency}.atom : les annonces d'une agence.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleAgencyFeed(w http.ResponseWriter, r *http.Request) {
+	name, found := strings.CutSuffix(r.PathValue("file"), ".atom")
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	agency, exists := findAgency(name)
+	if !exists {
+		http.Error(w, fmt.Sprintf("agence inconnue : %s", name), http.StatusNotFound)
+		return
+	}
+
+	announcements := api.store.Query(AnnouncementFilter{Agencies: []Agency{agency}}, "-first_seen")
+	writeAtomFeed(w, r, fmt.Sprintf("Annonces immobilières - %s", agency), announcements)
+}
+
+/**
+ * handleProfileFeed gère GET /feeds/profile/{name}.rss : les annonces d'un profil de recherche.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleProfileFeed(w http.ResponseWriter, r *http.Request) {
+	name, found := strings.CutSuffix(r.PathValue("file"), ".rss")
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	profile, exists := api.config.Get().Profile(name)
+	if !exists {
+		http.Error(w, fmt.Sprintf("profil inconnu : %s", name), http.StatusNotFound)
+		return
+	}
+
+	announcements := api.store.Query(profile.Filter(), "-first_seen")
+	writeRSSFeed(w, r, fmt.Sprintf("Annonces immobilières - %s", profile.Name), announcements)
+}
+
+/**
+ * writeAtomFeed écrit un flux Atom à partir des annonces, déjà triées de la plus récente à la plus ancienne.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP (pour construire les liens absolus).
+ * @param {string} title - Le titre du flux.
+ * @param {[]StoredAnnouncement} announcements - Les annonces à publier.
+ * @return {void}
+ */
+func writeAtomFeed(w http.ResponseWriter, r *http.Request, title string, announcements []StoredAnnouncement) {
+	announcements = limitFeedItems(announcements)
+	selfURL := requestBaseURL(r) + r.URL.Path
+
+	feed := atomFeed{
+		ID:      selfURL,
+		Title:   title,
+		Updated: feedUpdated(announcements).Format(time.RFC3339),
+		Links:   []atomLink{{Href: selfURL, Rel: "self", Type: "application/atom+xml"}},
+	}
+
+	for _, announcement := range announcements {
+		entry := atomEntry{
+			ID:        feedItemID(announcement),
+			Title:     feedItemTitle(announcement),
+			Published: announcement.FirstSeen.Format(time.RFC3339),
+			Updated:   announcement.LastSeen.Format(time.RFC3339),
+			Author:    atomAuthor{Name: string(announcement.Agency)},
+			Summary:   feedItemSummary(announcement),
+		}
+		if announcement.URL != "" {
+			entry.Links = append(entry.Links, atomLink{Href: announcement.URL, Rel: "alternate", Type: "text/html"})
+		}
+		if announcement.Photo != "" {
+			entry.Links = append(entry.Links, atomLink{Href: announcement.Photo, Rel: "enclosure", Type: photoMimeType(announcement.Photo)})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	writeXML(w, "application/atom+xml; charset=utf-8", feed)
+}
+
+/**
+ * writeRSSFeed écrit un flux RSS 2.0 à partir des annonces, déjà triées de la plus récente à la plus ancienne.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP (pour construire les liens absolus).
+ * @param {string} title - Le titre du flux.
+ * @param {[]StoredAnnouncement} announcements - Les annonces à publier.
+ * @return {void}
+ */
+func writeRSSFeed(w http.ResponseWriter, r *http.Request, title string, announcements []StoredAnnouncement) {
+	announcements = limitFeedItems(announcements)
+
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         title,
+			Link:          requestBaseURL(r) + r.URL.Path,
+			Description:   title,
+			LastBuildDate: feedUpdated(announcements).Format(time.RFC1123Z),
+		},
+	}
+
+	for _, announcement := range announcements {
+		item := rssItem{
+			Title:       feedItemTitle(announcement),
+			Link:        announcement.URL,
+			GUID:        rssGUID{Value: feedItemID(announcement)},
+			PubDate:     announcement.FirstSeen.Format(time.RFC1123Z),
+			Description: feedItemSummary(announcement),
+		}
+		if announcement.Photo != "" {
+			item.Enclosure = &rssEnclosure{URL: announcement.Photo, Type: photoMimeType(announcement.Photo)}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	writeXML(w, "application/rss+xml; charset=utf-8", feed)
+}
+
+/**
+ * limitFeedItems limite le nombre d'annonces publiées dans un flux.
+ * @param {[]StoredAnnouncement} announcements - Les annonces triées.
+ * @return {[]StoredAnnouncement} - Les annonces les plus récentes.
+ */
+func limitFeedItems(announcements []StoredAnnouncement) []StoredAnnouncement {
+	if len(announcements) > FeedMaxItems {
+		return announcements[:FeedMaxItems]
+	}
+	return announcements
+}
+
+/**
+ * feedUpdated retourne la date de dernière mise à jour d'un flux.
+ * @param {[]StoredAnnouncement} announcements - Les annonces du flux.
+ * @return {time.Time} - La date de la dernière annonce vue, ou maintenant si le flux est vide.
+ */
+func feedUpdated(announcements []StoredAnnouncement) time.Time {
+	var updated time.Time
+	for _, announcement := range announcements {
+		if announcement.LastSeen.After(updated) {
+			updated = announcement.LastSeen
+		}
+	}
+	if updated.IsZero() {
+		return time.Now()
+	}
+	return updated
+}
+
+/**
+ * feedItemID retourne un identifiant stable pour une annonce dans un flux.
+ * @param {StoredAnnouncement} announcement - L'annonce.
+ * @return {string} - Un URI tag: (RFC 4151) basé sur l'agence, la transaction et la référence, comme la clé du store.
+ */
+func feedItemID(announcement StoredAnnouncement) string {
+	return fmt.Sprintf("tag:agency-scraper,%s:%s/%s/%s",
+		announcement.FirstSeen.Format(time.DateOnly),
+		announcement.Agency.Slug(),
+		announcement.Transaction,
+		strings.ReplaceAll(announcement.Reference, " ", "-"),
+	)
+}
+
+/**
+ * feedItemTitle retourne le titre d'une annonce dans un flux (agence, titre et prix).
+ * @param {StoredAnnouncement} announcement - L'annonce.
+ * @return {string} - Le titre.
+ */
+func feedItemTitle(announcement StoredAnnouncement) string {
+	title := announcement.Title
+	if title == "" {
+		title = "Référence " + announcement.Reference
+	}
+	title = fmt.Sprintf("[%s] %s", announcement.Agency, title)
+	if announcement.Price > 0 {
+		title += fmt.Sprintf(" - %s", formatPrice(announcement.Price))
+	}
+	return title
+}
+
+/**
+ * feedItemSummary retourne le résumé texte d'une annonce dans un flux.
+ * @param {StoredAnnouncement} announcement - L'annonce.
+ * @return {string} - Le résumé.
+ */
+func feedItemSummary(announcement StoredAnnouncement) string {
+	lines := []string{"Référence : " + announcement.Reference}
+	if announcement.Price > 0 {
+		lines = append(lines, "Prix : "+formatPrice(announcement.Price))
+	}
+	if announcement.Surface > 0 {
+		lines = append(lines, fmt.Sprintf("Surface : %g m²", announcement.Surface))
+	}
+	if announcement.Rooms > 0 {
+		lines = append(lines, fmt.Sprintf("Pièces : %d", announcement.Rooms))
+	}
+	if announcement.City != "" {
+		lines = append(lines, "Ville : "+announcement.City)
+	}
+	if announcement.Status == StatusRemoved {
+		lines = append(lines, "Annonce retirée")
+	}
+	return strings.Join(lines, "\n")
+}
+
+/**
+ * formatPrice formate un prix en euros à la française, sans notation scientifique (ex: "650 €", "1 250 000 €", "812,5 €").
+ * Les milliers sont séparés par une espace fine insécable.
+ * @param {float64} price - Le prix.
+ * @return {string} - Le prix formaté.
+ */
+func formatPrice(price float64) string {
+	digits := strconv.FormatFloat(price, 'f', -1, 64)
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	integer, decimals, hasDecimals := strings.Cut(digits, ".")
+
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteString("\u202f")
+		}
+		grouped.WriteRune(digit)
+	}
+	if hasDecimals {
+		grouped.WriteString("," + decimals)
+	}
+	return sign + grouped.String() + " €"
+}
+
+/**
+ * photoMimeType devine le type MIME d'une photo à partir de son extension.
+ * @param {string} photoURL - L'URL de la photo.
+ * @return {string} - Le type MIME (image/jpeg par défaut).
+ */
+func photoMimeType(photoURL string) string {
+	path := strings.ToLower(strings.SplitN(photoURL, "?", 2)[0])
+	switch {
+	case strings.HasSuffix(path, ".png"):
+		return "image/png"
+	case strings.HasSuffix(path, ".webp"):
+		return "image/webp"
+	case strings.HasSuffix(path, ".gif"):
+		return "image/gif"
+	}
+	return "image/jpeg"
+}
+
+/**
+ * requestBaseURL retourne l'URL de base du serveur telle que vue par le client (derrière l'ingress compris).
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {string} - L'URL de base, sans slash final.
+ */
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := r.Header.Get("X-Forwarded-Proto"); forwarded != "" {
+		scheme = forwarded
+	}
+	return scheme + "://" + r.Host
+}
+
+/**
+ * writeXML écrit une réponse XML.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {string} contentType - Le type de contenu.
+ * @param {any} value - La valeur à encoder.
+ * @return {void}
+ */
+func writeXML(w http.ResponseWriter, contentType string, value any) {
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Printf("Erreur lors de l'écriture du flux : %v", err)
+	}
+}
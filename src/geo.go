@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Expressions régulières pour trouver les coordonnées dans les scripts des cartes (Leaflet, Google Maps, JSON)
+var (
+	latLngCallPattern = regexp.MustCompile(`\b(?:LatLng|setView|marker|center)\(\s*\[?\s*(-?\d{1,2}\.\d+)\s*,\s*(-?\d{1,3}\.\d+)`)
+
+	// La latitude et la longitude sont cherchées ensemble, dans le même objet (sans accolade entre les deux)
+	latLngPairPattern = regexp.MustCompile(`\blat(?:itude)?\b["']?\s*[:=]\s*["']?(-?\d{1,2}\.\d+)["']?[^{}]{0,80}?\b(?:lng|lon|long|longitude)\b["']?\s*[:=]\s*["']?(-?\d{1,3}\.\d+)`)
+	lngLatPairPattern = regexp.MustCompile(`\b(?:lng|lon|long|longitude)\b["']?\s*[:=]\s*["']?(-?\d{1,3}\.\d+)["']?[^{}]{0,80}?\blat(?:itude)?\b["']?\s*[:=]\s*["']?(-?\d{1,2}\.\d+)`)
+)
+
+// Conteneurs de la page parcourus dans l'ordre : ceux de l'annonce d'abord, puis toute la page
+var listingScopes = []string{"main ", "article ", "[class*='property'] ", "[class*='annonce'] ", ""}
+
+// Parties de la page qui ne décrivent pas le bien (carte de l'agence dans le pied de page, annonces similaires...)
+const nonListingContainers = "footer, header, nav, aside, #footer, .footer, [class*='similar'], [class*='similaire'], [class*='related']"
+
+/**
+ * extractCoordinates cherche les coordonnées du bien dans la page de détails.
+ * Les agences qui affichent une carte (La Foret, Nestenn, Guenno...) les exposent dans des balises meta,
+ * des attributs data-* du conteneur de la carte, ou dans le script d'initialisation de la carte.
+ * @param {colly.HTMLElement} page - L'élément <html> de la page.
+ * @return {float64} - La latitude.
+ * @return {float64} - La longitude.
+ * @return {bool} - Faux si aucune coordonnée valide n'a été trouvée.
+ */
+func extractCoordinates(page *colly.HTMLElement) (float64, float64, bool) {
+	// Balises meta de géolocalisation
+	if lat, lng, ok := parseCoordinates(
+		page.ChildAttr("meta[property='place:location:latitude']", "content"),
+		page.ChildAttr("meta[property='place:location:longitude']", "content"),
+	); ok {
+		return lat, lng, true
+	}
+	for _, name := range []string{"geo.position", "ICBM"} {
+		position := page.ChildAttr("meta[name='"+name+"']", "content")
+		if parts := strings.FieldsFunc(position, func(r rune) bool { return r == ';' || r == ',' }); len(parts) == 2 {
+			if lat, lng, ok := parseCoordinates(parts[0], parts[1]); ok {
+				return lat, lng, true
+			}
+		}
+	}
+
+	for _, scope := range listingScopes {
+		// Attributs data-* du conteneur de la carte
+		for _, attrs := range [][2]string{{"data-lat", "data-lng"}, {"data-lat", "data-lon"}, {"data-latitude", "data-longitude"}} {
+			if lat, lng, ok := findListingCoordinates(page, scope+"["+attrs[0]+"]["+attrs[1]+"]", func(el *colly.HTMLElement) (float64, float64, bool) {
+				return parseCoordinates(el.Attr(attrs[0]), el.Attr(attrs[1]))
+			}); ok {
+				return lat, lng, true
+			}
+		}
+
+		// Scripts d'initialisation de la carte et données JSON embarquées
+		if lat, lng, ok := findListingCoordinates(page, scope+"script", func(script *colly.HTMLElement) (float64, float64, bool) {
+			return extractCoordinatesFromScript(script.Text)
+		}); ok {
+			return lat, lng, true
+		}
+	}
+	return 0, 0, false
+}
+
+/**
+ * findListingCoordinates retourne les premières coordonnées trouvées dans les éléments d'un sélecteur,
+ * en ignorant les parties de la page qui ne décrivent pas le bien.
+ * @param {colly.HTMLElement} page - L'élément <html> de la page.
+ * @param {string} selector - Le sélecteur des éléments.
+ * @param {func(*colly.HTMLElement) (float64, float64, bool)} parse - Lit les coordonnées d'un élément.
+ * @return {float64} - La latitude.
+ * @return {float64} - La longitude.
+ * @return {bool} - Faux si aucune coordonnée valide n'a été trouvée.
+ */
+func findListingCoordinates(page *colly.HTMLElement, selector string, parse func(*colly.HTMLElement) (float64, float64, bool)) (float64, float64, bool) {
+	var lat, lng float64
+	var found bool
+	page.ForEachWithBreak(selector, func(_ int, el *colly.HTMLElement) bool {
+		if el.DOM.Closest(nonListingContainers).Length() > 0 {
+			return true
+		}
+		lat, lng, found = parse(el)
+		return !found
+	})
+	return lat, lng, found
+}
+
+/**
+ * extractCoordinatesFromScript cherche des coordonnées dans le code d'un script.
+ * @param {string} script - Le code du script.
+ * @return {float64} - La latitude.
+ * @return {float64} - La longitude.
+ * @return {bool} - Faux si aucune coordonnée valide n'a été trouvée.
+ */
+func extractCoordinatesFromScript(script string) (float64, float64, bool) {
+	if match := latLngCallPattern.FindStringSubmatch(script); match != nil {
+		if lat, lng, ok := parseCoordinates(match[1], match[2]); ok {
+			return lat, lng, true
+		}
+	}
+
+	if match := latLngPairPattern.FindStringSubmatch(script); match != nil {
+		if lat, lng, ok := parseCoordinates(match[1], match[2]); ok {
+			return lat, lng, true
+		}
+	}
+	if match := lngLatPairPattern.FindStringSubmatch(script); match != nil {
+		return parseCoordinates(match[2], match[1])
+	}
+	return 0, 0, false
+}
+
+/**
+ * parseCoordinates convertit et valide une latitude et une longitude.
+ * @param {string} latitude - La latitude.
+ * @param {string} longitude - La longitude.
+ * @return {float64} - La latitude.
+ * @return {float64} - La longitude.
+ * @return {bool} - Faux si les valeurs sont invalides ou nulles (carte non initialisée).
+ */
+func parseCoordinates(latitude string, longitude string) (float64, float64, bool) {
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latitude), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(longitude), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 || (lat == 0 && lng == 0) {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+/**
+ * geoJSONFeatureCollection est une collection de points GeoJSON (RFC 7946).
+ */
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+/**
+ * geoJSONFeature est une annonce localisée sur la carte.
+ */
+type geoJSONFeature struct {
+	Type       string         `json:"type"`
+	Geometry   geoJSONPoint   `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+/**
+ * geoJSONPoint est la position d'une annonce (longitude puis latitude, comme l'impose GeoJSON).
+ */
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+/**
+ * newGeoJSONFeatureCollection construit la collection GeoJSON des annonces localisées.
+ * Les annonces sans coordonnées sont ignorées.
+ * @param {[]StoredAnnouncement} announcements - Les annonces.
+ * @return {geoJSONFeatureCollection} - La collection GeoJSON.
+ */
+func newGeoJSONFeatureCollection(announcements []StoredAnnouncement) geoJSONFeatureCollection {
+	collection := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+
+	for _, announcement := range announcements {
+		if announcement.Latitude == 0 && announcement.Longitude == 0 {
+			continue
+		}
+
+		collection.Features = append(collection.Features, geoJSONFeature{
+			Type: "Feature",
+			Geometry: geoJSONPoint{
+				Type:        "Point",
+				Coordinates: [2]float64{announcement.Longitude, announcement.Latitude},
+			},
+			Properties: map[string]any{
+				"agency":      announcement.Agency,
+				"transaction": announcement.Transaction,
+				"reference":   announcement.Reference,
+				"url":         announcement.URL,
+				"title":       announcement.Title,
+				"price":       announcement.Price,
+				"surface":     announcement.Surface,
+				"rooms":       announcement.Rooms,
+				"city":        announcement.City,
+				"status":      announcement.Status,
+				"first_seen":  announcement.FirstSeen,
+			},
+		})
+	}
+
+	return collection
+}
+
+/**
+ * handleGeoJSON gère GET /announcements.geojson, avec les mêmes filtres que GET /announcements.
+ * @param {http.ResponseWriter} w - La réponse HTTP.
+ * @param {*http.Request} r - La requête HTTP.
+ * @return {void}
+ */
+func (api *APIServer) handleGeoJSON(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAnnouncementFilter(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	collection := newGeoJSONFeatureCollection(api.store.Query(filter, "-first_seen"))
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	if err := json.NewEncoder(w).Encode(collection); err != nil {
+		log.Printf("Erreur lors de l'écriture du GeoJSON : %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// En-têtes communs aux navigateurs Chromium (Chrome, Edge) sur une navigation
+var chromiumNavigationHeaders = map[string]string{
+	"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+	"Accept-Language":           "fr-FR,fr;q=0.9,en-US;q=0.8,en;q=0.7",
+	"Upgrade-Insecure-Requests": "1",
+	"Sec-Fetch-Dest":            "document",
+	"Sec-Fetch-Mode":            "navigate",
+	"Sec-Fetch-Site":            "none",
+	"Sec-Fetch-User":            "?1",
+}
+
+// En-têtes de Firefox sur une navigation (Firefox n'envoie pas les en-têtes sec-ch-ua)
+var firefoxNavigationHeaders = map[string]string{
+	"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+	"Accept-Language":           "fr,fr-FR;q=0.8,en-US;q=0.5,en;q=0.3",
+	"Upgrade-Insecure-Requests": "1",
+	"Sec-Fetch-Dest":            "document",
+	"Sec-Fetch-Mode":            "navigate",
+	"Sec-Fetch-Site":            "none",
+	"Sec-Fetch-User":            "?1",
+}
+
+/**
+ * HeaderProfile est un profil d'en-têtes HTTP cohérent avec un navigateur : User-Agent, Accept, Accept-Language
+ * et sec-ch-ua correspondent au même navigateur, pour ne pas être repéré par des en-têtes Go par défaut.
+ * Accept-Encoding n'est pas défini : le transport Go l'ajoute et décompresse lui-même les réponses gzip.
+ * @property {string} Name - Le nom du profil (ex: "chrome-windows").
+ * @property {string} UserAgent - Le User-Agent du navigateur.
+ * @property {map[string]string} Headers - Les autres en-têtes envoyés à chaque requête.
+ */
+type HeaderProfile struct {
+	Name      string            `json:"name"`
+	UserAgent string            `json:"userAgent"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+/**
+ * defaultHeaderProfiles sont les profils utilisés quand la configuration n'en définit pas.
+ */
+var defaultHeaderProfiles = []HeaderProfile{
+	{
+		Name:      "chrome-windows",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+		Headers: withHeaders(chromiumNavigationHeaders, map[string]string{
+			"Sec-Ch-Ua":          `"Google Chrome";v="129", "Not=A?Brand";v="8", "Chromium";v="129"`,
+			"Sec-Ch-Ua-Mobile":   "?0",
+			"Sec-Ch-Ua-Platform": `"Windows"`,
+		}),
+	},
+	{
+		Name:      "chrome-macos",
+		UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+		Headers: withHeaders(chromiumNavigationHeaders, map[string]string{
+			"Sec-Ch-Ua":          `"Google Chrome";v="129", "Not=A?Brand";v="8", "Chromium";v="129"`,
+			"Sec-Ch-Ua-Mobile":   "?0",
+			"Sec-Ch-Ua-Platform": `"macOS"`,
+		}),
+	},
+	{
+		Name:      "edge-windows",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.0.0",
+		Headers: withHeaders(chromiumNavigationHeaders, map[string]string{
+			"Sec-Ch-Ua":          `"Microsoft Edge";v="129", "Not=A?Brand";v="8", "Chromium";v="129"`,
+			"Sec-Ch-Ua-Mobile":   "?0",
+			"Sec-Ch-Ua-Platform": `"Windows"`,
+		}),
+	},
+	{
+		Name:      "firefox-windows",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0",
+		Headers:   withHeaders(firefoxNavigationHeaders, nil),
+	},
+	{
+		Name:      "firefox-linux",
+		UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0",
+		Headers:   withHeaders(firefoxNavigationHeaders, nil),
+	},
+	{
+		Name:      "safari-macos",
+		UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Safari/605.1.15",
+		Headers: map[string]string{
+			"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			"Accept-Language": "fr-FR,fr;q=0.9",
+			"Sec-Fetch-Dest":  "document",
+			"Sec-Fetch-Mode":  "navigate",
+			"Sec-Fetch-Site":  "none",
+		},
+	},
+}
+
+/**
+ * withHeaders copie des en-têtes communs et y ajoute des en-têtes propres au profil.
+ * @param {map[string]string} base - Les en-têtes communs.
+ * @param {map[string]string} extra - Les en-têtes propres au profil.
+ * @return {map[string]string} - Les en-têtes du profil.
+ */
+func withHeaders(base map[string]string, extra map[string]string) map[string]string {
+	headers := make(map[string]string, len(base)+len(extra))
+	for name, value := range base {
+		headers[name] = value
+	}
+	for name, value := range extra {
+		headers[name] = value
+	}
+	return headers
+}
+
+/**
+ * validateHeaderProfiles vérifie que les profils ont un nom unique et un User-Agent.
+ * @param {[]HeaderProfile} profiles - Les profils.
+ * @return {error} - La première erreur trouvée.
+ */
+func validateHeaderProfiles(profiles []HeaderProfile) error {
+	names := make(map[string]bool)
+	for i, profile := range profiles {
+		if profile.Name == "" {
+			return fmt.Errorf("profil d'en-têtes n°%d sans nom", i+1)
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("profil d'en-têtes %q défini plusieurs fois", profile.Name)
+		}
+		names[profile.Name] = true
+		if profile.UserAgent == "" {
+			return fmt.Errorf("profil d'en-têtes %q sans userAgent", profile.Name)
+		}
+	}
+	return nil
+}
+
+/**
+ * findHeaderProfile retourne un profil d'en-têtes par son nom.
+ * @param {[]HeaderProfile} profiles - Les profils.
+ * @param {string} name - Le nom du profil.
+ * @return {HeaderProfile} - Le profil.
+ * @return {bool} - Faux si le profil n'existe pas.
+ */
+func findHeaderProfile(profiles []HeaderProfile, name string) (HeaderProfile, bool) {
+	for _, profile := range profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return HeaderProfile{}, false
+}
+
+/**
+ * pickHeaderProfile choisit le profil d'en-têtes d'une session de scraping : le profil imposé à l'agence,
+ * sinon un profil tiré au hasard. Le même profil est gardé pour toutes les requêtes de la session.
+ * @param {AgencySettings} settings - Les réglages de l'agence.
+ * @return {HeaderProfile} - Le profil.
+ */
+func pickHeaderProfile(settings AgencySettings) HeaderProfile {
+	profiles := settings.headerProfiles
+	if len(profiles) == 0 {
+		profiles = defaultHeaderProfiles
+	}
+
+	if profile, exists := findHeaderProfile(profiles, settings.HeaderProfile); exists {
+		return profile
+	}
+	// Le générateur global est sûr entre goroutines : les agences sont scrapées en parallèle
+	return profiles[rand.Intn(len(profiles))]
+}
+
+/**
+ * applyHeaderProfile envoie les en-têtes du profil de la session à chaque requête du collecteur.
+ * Les en-têtes déjà définis par la requête (AJAX, formulaires...) sont conservés.
+ * @param {colly.Collector} collector - Le collecteur.
+ * @return {void}
+ */
+func (collyService *CollyService) applyHeaderProfile(collector *colly.Collector) {
+	profile := collyService.headerProfile
+	collector.UserAgent = profile.UserAgent
+
+	collector.OnRequest(func(r *colly.Request) {
+		for name, value := range profile.Headers {
+			if r.Headers.Get(name) == "" {
+				r.Headers.Set(name, value)
+			}
+		}
+	})
+}
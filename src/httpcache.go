@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dossier par défaut du cache HTTP des pages de résultats
+const DefaultHTTPCacheDir = "data/http-cache"
+
+// Clé du contexte Colly qui marque la première page de résultats d'un cycle
+const entryPageKey = "entryPage"
+
+// En-tête ajouté aux réponses servies par le cache HTTP : "fresh" (sans requête) ou "revalidated" (réponse 304)
+const cacheStatusHeader = "X-Cache-Status"
+
+/**
+ * cachedResponse est une réponse conservée dans le cache HTTP.
+ * @property {string} URL - L'URL de la page.
+ * @property {int} StatusCode - Le code HTTP de la réponse.
+ * @property {http.Header} Header - Les en-têtes de la réponse.
+ * @property {[]byte} Body - Le contenu de la page.
+ * @property {time.Time} StoredAt - Date de réception ou de dernière revalidation de la réponse.
+ */
+type cachedResponse struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"stored_at"`
+}
+
+/**
+ * HTTPCache est un cache HTTP sur disque qui respecte ETag, Last-Modified et Cache-Control :
+ * une réponse encore fraîche est servie sans requête, sinon elle est revalidée par une requête conditionnelle.
+ * @property {string} dir - Le dossier du cache.
+ * @property {http.RoundTripper} base - Le transport utilisé pour les requêtes.
+ */
+type HTTPCache struct {
+	dir  string
+	base http.RoundTripper
+}
+
+/**
+ * NewHTTPCache crée un cache HTTP sur disque autour d'un transport.
+ * @param {string} dir - Le dossier du cache.
+ * @param {http.RoundTripper} base - Le transport utilisé pour les requêtes.
+ * @return {*HTTPCache} - Le cache, utilisable comme transport.
+ */
+func NewHTTPCache(dir string, base http.RoundTripper) *HTTPCache {
+	return &HTTPCache{dir: dir, base: base}
+}
+
+/**
+ * RoundTrip sert la requête depuis le cache si la réponse est fraîche, la revalide sinon.
+ * Seules les requêtes GET sont mises en cache.
+ * @param {*http.Request} request - La requête.
+ * @return {*http.Response} - La réponse, du site ou du cache.
+ * @return {error} - Erreur de la requête.
+ */
+func (cache *HTTPCache) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Method != http.MethodGet {
+		return cache.base.RoundTrip(request)
+	}
+
+	cached := cache.load(request.URL.String())
+	if cached != nil && cached.isFresh(time.Now()) && !hasCacheDirective(request.Header, "no-cache") {
+		return cached.response(request, "fresh"), nil
+	}
+
+	// Requête conditionnelle : le site répond 304 si la page n'a pas changé
+	if cached != nil {
+		request = request.Clone(request.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			request.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	response, err := cache.base.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotModified && cached != nil {
+		response.Body.Close()
+		// Les en-têtes de la réponse 304 (Cache-Control, ETag...) remplacent ceux conservés
+		for name, values := range response.Header {
+			cached.Header[name] = values
+		}
+		cached.StoredAt = time.Now()
+		cache.save(cached)
+		return cached.response(response.Request, "revalidated"), nil
+	}
+
+	if response.StatusCode != http.StatusOK || hasCacheDirective(response.Header, "no-store") {
+		return response, nil
+	}
+
+	// Lire la réponse pour la conserver, puis la rendre au collecteur
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	stored := &cachedResponse{URL: request.URL.String(), StatusCode: response.StatusCode, Header: response.Header.Clone(), Body: body, StoredAt: time.Now()}
+	if stored.Header.Get("ETag") != "" || stored.Header.Get("Last-Modified") != "" || stored.maxAge() > 0 {
+		cache.save(stored)
+	}
+	return response, nil
+}
+
+/**
+ * path retourne le fichier du cache d'une URL.
+ * @param {string} url - L'URL.
+ * @return {string} - Le chemin du fichier.
+ */
+func (cache *HTTPCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(cache.dir, name[:2], name+".json")
+}
+
+/**
+ * load lit la réponse conservée pour une URL.
+ * @param {string} url - L'URL.
+ * @return {*cachedResponse} - La réponse, nil si elle n'est pas dans le cache.
+ */
+func (cache *HTTPCache) load(url string) *cachedResponse {
+	data, err := os.ReadFile(cache.path(url))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Lecture du cache HTTP impossible pour %s : %v", url, err)
+		}
+		return nil
+	}
+
+	var cached cachedResponse
+	if err := json.Unmarshal(data, &cached); err != nil || cached.URL != url {
+		return nil
+	}
+	return &cached
+}
+
+/**
+ * save écrit une réponse dans le cache, de façon atomique.
+ * @param {*cachedResponse} cached - La réponse.
+ * @return {void}
+ */
+func (cache *HTTPCache) save(cached *cachedResponse) {
+	path := cache.path(cached.URL)
+	data, err := json.Marshal(cached)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(path+".tmp", data, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		log.Printf("Écriture du cache HTTP impossible pour %s : %v", cached.URL, err)
+	}
+}
+
+/**
+ * response construit la réponse HTTP servie depuis le cache.
+ * @param {*http.Request} request - La requête.
+ * @param {string} status - "fresh" ou "revalidated", ajouté dans l'en-tête X-Cache-Status.
+ * @return {*http.Response} - La réponse.
+ */
+func (cached *cachedResponse) response(request *http.Request, status string) *http.Response {
+	header := cached.Header.Clone()
+	header.Set(cacheStatusHeader, status)
+	return &http.Response{
+		Status:        strconv.Itoa(cached.StatusCode) + " " + http.StatusText(cached.StatusCode),
+		StatusCode:    cached.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+		ContentLength: int64(len(cached.Body)),
+		Request:       request,
+	}
+}
+
+/**
+ * isFresh indique si la réponse peut être servie sans requête (Cache-Control max-age ou Expires).
+ * @param {time.Time} now - La date courante.
+ * @return {bool} - Vrai si la réponse est fraîche.
+ */
+func (cached *cachedResponse) isFresh(now time.Time) bool {
+	if hasCacheDirective(cached.Header, "no-cache") {
+		return false
+	}
+	if maxAge := cached.maxAge(); maxAge > 0 {
+		return now.Before(cached.StoredAt.Add(maxAge))
+	}
+	if expires, err := http.ParseTime(cached.Header.Get("Expires")); err == nil {
+		return now.Before(expires)
+	}
+	return false
+}
+
+/**
+ * maxAge retourne la durée de fraîcheur de la réponse (Cache-Control: max-age), 0 si elle n'est pas définie.
+ * @return {time.Duration} - La durée de fraîcheur.
+ */
+func (cached *cachedResponse) maxAge() time.Duration {
+	for _, directive := range strings.Split(cached.Header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return 0
+}
+
+/**
+ * hasCacheDirective indique si l'en-tête Cache-Control contient une directive.
+ * @param {http.Header} header - Les en-têtes.
+ * @param {string} directive - La directive (ex: "no-store").
+ * @return {bool} - Vrai si la directive est présente.
+ */
+func hasCacheDirective(header http.Header, directive string) bool {
+	for _, value := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if strings.EqualFold(name, directive) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,6 +1,19 @@
 package main
 
+import (
+	"log"
+	"os"
+)
+
 // Point d'entrée de l'application
 func main() {
-	RunScraper(1)
+	// Sous-commande d'export des annonces stockées
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExportCommand(os.Args[2:]); err != nil {
+			log.Fatalf("Erreur lors de l'export : %v", err)
+		}
+		return
+	}
+
+	RunScraper(1, parseOptions(os.Args[1:]))
 }
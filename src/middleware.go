@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+/**
+ * CacheBustStrategy est la façon d'éviter les pages servies par un cache intermédiaire.
+ */
+type CacheBustStrategy string
+
+/**
+ * Constantes pour les stratégies d'invalidation du cache.
+ */
+const (
+	CacheBustNone   CacheBustStrategy = "none"   // Requêtes envoyées telles quelles
+	CacheBustQuery  CacheBustStrategy = "query"  // Paramètre _=<horodatage> ajouté à l'URL
+	CacheBustHeader CacheBustStrategy = "header" // En-têtes Cache-Control et Pragma: no-cache, sans modifier l'URL
+)
+
+/**
+ * URLRewrite réécrit le chemin et les paramètres des URLs visitées.
+ * @property {string} Pattern - L'expression régulière appliquée au chemin et aux paramètres (ex: "^/annonce/(\\d+)$").
+ * @property {string} Replace - Le remplacement, avec les groupes $1, $2... (ex: "/annonce/$1?print=1").
+ */
+type URLRewrite struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+/**
+ * RequestOptions décrit la chaîne de traitement des requêtes d'une agence, appliquée dans l'ordre :
+ * réécriture des URLs, invalidation du cache, en-têtes, Referer et cookies.
+ * @property {CacheBustStrategy} CacheBust - La stratégie d'invalidation du cache (none par défaut).
+ * @property {map[string]string} Headers - Les en-têtes ajoutés à chaque requête, prioritaires sur le profil d'en-têtes.
+ * @property {bool} Referer - Envoie en Referer la dernière page visitée, comme un navigateur qui suit les liens.
+ * @property {map[string]string} Cookies - Les cookies déposés avant la première requête vers chaque site (consentement...).
+ * @property {[]URLRewrite} Rewrites - Les réécritures des URLs visitées.
+ */
+type RequestOptions struct {
+	CacheBust CacheBustStrategy `json:"cacheBust,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Referer   bool              `json:"referer,omitempty"`
+	Cookies   map[string]string `json:"cookies,omitempty"`
+	Rewrites  []URLRewrite      `json:"rewrites,omitempty"`
+}
+
+/**
+ * requestOptionsProvider est implémenté par les adaptateurs de plateforme qui ont besoin d'un traitement des requêtes.
+ */
+type requestOptionsProvider interface {
+	requestOptions() RequestOptions
+}
+
+/**
+ * agencyRequestOptions déclare le traitement des requêtes propre aux agences sans adaptateur de plateforme.
+ */
+var agencyRequestOptions = map[Agency]RequestOptions{
+	// Les pages rendues côté serveur de ces sites sont mises en cache par leur CDN
+	Foncia:        {CacheBust: CacheBustHeader},
+	SquareHabitat: {CacheBust: CacheBustHeader},
+}
+
+/**
+ * requestMiddleware est une étape de la chaîne de traitement des requêtes.
+ */
+type requestMiddleware func(r *colly.Request)
+
+/**
+ * Merge complète les options déclarées par le code avec celles de la configuration, prioritaires.
+ * @param {RequestOptions} override - Les options de la configuration.
+ * @return {RequestOptions} - Les options fusionnées.
+ */
+func (options RequestOptions) Merge(override RequestOptions) RequestOptions {
+	merged := RequestOptions{
+		CacheBust: options.CacheBust,
+		Headers:   withHeaders(options.Headers, override.Headers),
+		Referer:   options.Referer || override.Referer,
+		Cookies:   withHeaders(options.Cookies, override.Cookies),
+		Rewrites:  append(append([]URLRewrite(nil), options.Rewrites...), override.Rewrites...),
+	}
+	if override.CacheBust != "" {
+		merged.CacheBust = override.CacheBust
+	}
+	return merged
+}
+
+/**
+ * Validate vérifie la stratégie d'invalidation du cache et les expressions des réécritures.
+ * @return {error} - La première erreur trouvée.
+ */
+func (options RequestOptions) Validate() error {
+	switch options.CacheBust {
+	case "", CacheBustNone, CacheBustQuery, CacheBustHeader:
+	default:
+		return fmt.Errorf("cacheBust inconnu : %q (none, query ou header)", options.CacheBust)
+	}
+	for _, rewrite := range options.Rewrites {
+		if _, err := regexp.Compile(rewrite.Pattern); err != nil {
+			return fmt.Errorf("réécriture %q invalide : %w", rewrite.Pattern, err)
+		}
+	}
+	return nil
+}
+
+/**
+ * resolveRequestOptions retourne le traitement des requêtes d'une agence : celui déclaré par son adaptateur
+ * ou pour l'agence, complété par la configuration.
+ * @param {Agency} agency - L'agence.
+ * @param {RequestOptions} configured - Les options de la configuration de l'agence.
+ * @return {RequestOptions} - Les options.
+ */
+func resolveRequestOptions(agency Agency, configured RequestOptions) RequestOptions {
+	declared := agencyRequestOptions[agency]
+	if adapter, exists := findSiteAdapter(agency); exists {
+		if provider, ok := adapter.(requestOptionsProvider); ok {
+			declared = provider.requestOptions()
+		}
+	}
+	return declared.Merge(configured)
+}
+
+/**
+ * refererChain retient la dernière page visitée par les collecteurs d'une session, pour l'en-tête Referer.
+ */
+type refererChain struct {
+	mu   sync.Mutex
+	last string
+}
+
+/**
+ * applyRequestMiddlewares enregistre la chaîne de traitement des requêtes de l'agence sur un collecteur.
+ * @param {colly.Collector} collector - Le collecteur.
+ * @return {void}
+ */
+func (collyService *CollyService) applyRequestMiddlewares(collector *colly.Collector) {
+	options := resolveRequestOptions(collyService.agency, collyService.settings.Requests)
+
+	var middlewares []requestMiddleware
+	if len(options.Rewrites) > 0 {
+		middlewares = append(middlewares, rewriteURLs(options.Rewrites))
+	}
+	switch options.CacheBust {
+	case CacheBustQuery:
+		middlewares = append(middlewares, cacheBustQuery)
+	case CacheBustHeader:
+		middlewares = append(middlewares, cacheBustHeader)
+	}
+	if len(options.Headers) > 0 {
+		middlewares = append(middlewares, setHeaders(options.Headers))
+	}
+	if options.Referer {
+		middlewares = append(middlewares, chainReferer(collector, &collyService.referers))
+	}
+	if len(options.Cookies) > 0 {
+		middlewares = append(middlewares, seedCookies(collector, options.Cookies))
+	}
+
+	if len(middlewares) == 0 {
+		return
+	}
+	collector.OnRequest(func(r *colly.Request) {
+		// Garder l'URL d'origine : c'est elle qui est stockée et notifiée, pas l'URL réécrite ou horodatée
+		r.Ctx.Put(originalURLKey(r), r.URL.String())
+		for _, middleware := range middlewares {
+			middleware(r)
+		}
+	})
+}
+
+/**
+ * originalURLKey retourne la clé du contexte Colly où est gardée l'URL d'une requête avant ses middlewares.
+ * Le contexte est partagé par les requêtes lancées depuis une même page : la clé contient l'identifiant de la requête.
+ * @param {colly.Request} r - La requête.
+ * @return {string} - La clé.
+ */
+func originalURLKey(r *colly.Request) string {
+	return "originalURL#" + strconv.FormatUint(uint64(r.ID), 10)
+}
+
+/**
+ * requestURL retourne l'URL d'une requête telle qu'elle a été demandée, sans les réécritures ni le paramètre
+ * d'invalidation du cache ajoutés par les middlewares : l'URL à stocker et à notifier.
+ * @param {colly.Request} r - La requête.
+ * @return {string} - L'URL.
+ */
+func requestURL(r *colly.Request) string {
+	if original := r.Ctx.Get(originalURLKey(r)); original != "" {
+		return original
+	}
+	return r.URL.String()
+}
+
+/**
+ * rewriteURLs réécrit le chemin et les paramètres des URLs ; le domaine n'est jamais modifié.
+ * @param {[]URLRewrite} rewrites - Les réécritures, appliquées dans l'ordre.
+ * @return {requestMiddleware} - L'étape de réécriture.
+ */
+func rewriteURLs(rewrites []URLRewrite) requestMiddleware {
+	patterns := make([]*regexp.Regexp, len(rewrites))
+	for i, rewrite := range rewrites {
+		patterns[i] = regexp.MustCompile(rewrite.Pattern)
+	}
+
+	return func(r *colly.Request) {
+		requestURI := r.URL.RequestURI()
+		rewritten := requestURI
+		for i, pattern := range patterns {
+			rewritten = pattern.ReplaceAllString(rewritten, rewrites[i].Replace)
+		}
+		if rewritten == requestURI {
+			return
+		}
+
+		// La requête Colly partage son URL avec la requête HTTP : elle est modifiée sur place
+		parsed, err := r.URL.Parse(rewritten)
+		if err != nil || parsed.Host != r.URL.Host {
+			log.Printf("Réécriture ignorée pour %s : %q n'est pas un chemin valide", r.URL, rewritten)
+			return
+		}
+		*r.URL = *parsed
+	}
+}
+
+/**
+ * cacheBustQuery ajoute un paramètre _=<horodatage> unique à l'URL, avec ou sans paramètres existants.
+ * @param {colly.Request} r - La requête.
+ * @return {void}
+ */
+func cacheBustQuery(r *colly.Request) {
+	param := "_=" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if r.URL.RawQuery == "" {
+		r.URL.RawQuery = param
+	} else {
+		r.URL.RawQuery += "&" + param
+	}
+}
+
+/**
+ * cacheBustHeader demande une page fraîche aux caches intermédiaires, comme un navigateur qui recharge la page.
+ * @param {colly.Request} r - La requête.
+ * @return {void}
+ */
+func cacheBustHeader(r *colly.Request) {
+	r.Headers.Set("Cache-Control", "no-cache")
+	r.Headers.Set("Pragma", "no-cache")
+}
+
+/**
+ * setHeaders ajoute des en-têtes à chaque requête.
+ * @param {map[string]string} headers - Les en-têtes.
+ * @return {requestMiddleware} - L'étape d'ajout des en-têtes.
+ */
+func setHeaders(headers map[string]string) requestMiddleware {
+	return func(r *colly.Request) {
+		for name, value := range headers {
+			r.Headers.Set(name, value)
+		}
+	}
+}
+
+/**
+ * chainReferer envoie en Referer la dernière page visitée pendant la session, page de résultats ou page de détails.
+ * @param {colly.Collector} collector - Le collecteur, dont les réponses mettent à jour la dernière page.
+ * @param {*refererChain} chain - La dernière page visitée, partagée par les collecteurs de la session.
+ * @return {requestMiddleware} - L'étape d'ajout du Referer.
+ */
+func chainReferer(collector *colly.Collector, chain *refererChain) requestMiddleware {
+	collector.OnResponse(func(r *colly.Response) {
+		chain.mu.Lock()
+		defer chain.mu.Unlock()
+		chain.last = r.Request.URL.String()
+	})
+
+	return func(r *colly.Request) {
+		chain.mu.Lock()
+		defer chain.mu.Unlock()
+		if chain.last != "" && r.Headers.Get("Referer") == "" {
+			r.Headers.Set("Referer", chain.last)
+		}
+	}
+}
+
+/**
+ * seedCookies dépose des cookies dans le collecteur avant la première requête vers chaque site.
+ * Les cookies renvoyés ensuite par le site remplacent ceux déposés.
+ * @param {colly.Collector} collector - Le collecteur.
+ * @param {map[string]string} cookies - Les cookies (nom et valeur).
+ * @return {requestMiddleware} - L'étape de dépôt des cookies.
+ */
+func seedCookies(collector *colly.Collector, cookies map[string]string) requestMiddleware {
+	var mu sync.Mutex
+	seeded := make(map[string]bool)
+
+	return func(r *colly.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if seeded[r.URL.Host] {
+			return
+		}
+		seeded[r.URL.Host] = true
+
+		jarCookies := make([]*http.Cookie, 0, len(cookies))
+		for name, value := range cookies {
+			jarCookies = append(jarCookies, &http.Cookie{Name: name, Value: value, Path: "/"})
+		}
+		if err := collector.SetCookies(r.URL.Scheme+"://"+r.URL.Host+"/", jarCookies); err != nil {
+			log.Printf("Impossible de déposer les cookies pour %s : %v", r.URL.Host, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * Notifier est l'interface des canaux de notification des nouvelles annonces.
+ */
+type Notifier interface {
+	Notify(message string)
+	NotifyAdmin(message string)
+}
+
+/**
+ * TelegramNotifier envoie les messages sur le canal Telegram public, et les alertes sur le chat d'administration.
+ * @property {atomic.Int64} adminChatID - Identifiant du chat Telegram d'administration (alertes écrites dans les logs si 0).
+ */
+type TelegramNotifier struct {
+	adminChatID atomic.Int64
+}
+
+/**
+ * Notify envoie le message sur le canal Telegram public.
+ * @param {string} message - Le message à envoyer.
+ * @return {void}
+ */
+func (*TelegramNotifier) Notify(message string) {
+	sendTelegramMessageToPublicChannel(message)
+}
+
+/**
+ * NotifyAdmin envoie une alerte sur le chat Telegram d'administration.
+ * @param {string} message - L'alerte à envoyer.
+ * @return {void}
+ */
+func (notifier *TelegramNotifier) NotifyAdmin(message string) {
+	adminChatID := notifier.adminChatID.Load()
+	if adminChatID == 0 {
+		log.Printf("Alerte non envoyée (adminChatID non configuré) : %s", message)
+		return
+	}
+	sendTelegramMessageToAdminChat(adminChatID, message)
+}
+
+/**
+ * SetAdminChatID change le chat Telegram d'administration, au rechargement de la configuration.
+ * @param {int64} adminChatID - Identifiant du chat Telegram d'administration (0 si aucun).
+ * @return {void}
+ */
+func (notifier *TelegramNotifier) SetAdminChatID(adminChatID int64) {
+	notifier.adminChatID.Store(adminChatID)
+}
+
+/**
+ * DryRunNotifier écrit les messages au lieu de les envoyer, pour les tests en local.
+ * @property {sync.Mutex} mu - Verrou pour ne pas mélanger les messages écrits en parallèle.
+ * @property {io.Writer} output - Destination des messages.
+ */
+type DryRunNotifier struct {
+	mu     sync.Mutex
+	output io.Writer
+}
+
+/**
+ * Notify écrit le message exact qui aurait été envoyé sur Telegram.
+ * @param {string} message - Le message à écrire.
+ * @return {void}
+ */
+func (notifier *DryRunNotifier) Notify(message string) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	_, err := fmt.Fprintf(notifier.output, "----- [DRY-RUN] %s -----\n%s\n\n", time.Now().Format(time.RFC3339), message)
+	if err != nil {
+		log.Printf("Erreur lors de l'écriture du message en mode dry-run : %v", err)
+	}
+}
+
+/**
+ * NotifyAdmin écrit l'alerte qui aurait été envoyée sur le chat d'administration.
+ * @param {string} message - L'alerte à écrire.
+ * @return {void}
+ */
+func (notifier *DryRunNotifier) NotifyAdmin(message string) {
+	notifier.Notify("[ADMIN] " + message)
+}
+
+/**
+ * NewNotifier crée le notifier correspondant aux options de la ligne de commande.
+ * @param {Options} options - Les options de la ligne de commande.
+ * @param {int64} adminChatID - Identifiant du chat Telegram d'administration (0 si aucun).
+ * @return {Notifier} - Le notifier à utiliser.
+ */
+func NewNotifier(options Options, adminChatID int64) Notifier {
+	if !options.dryRun {
+		notifier := &TelegramNotifier{}
+		notifier.SetAdminChatID(adminChatID)
+		return notifier
+	}
+
+	if options.dryRunOutput == "" {
+		log.Println("Mode dry-run activé : les messages sont écrits sur la sortie standard.")
+		return &DryRunNotifier{output: os.Stdout}
+	}
+
+	file, err := os.OpenFile(options.dryRunOutput, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Fatalf("Impossible d'ouvrir le fichier de sortie du mode dry-run : %v", err)
+	}
+
+	log.Printf("Mode dry-run activé : les messages sont écrits dans %s.", options.dryRunOutput)
+	return &DryRunNotifier{output: file}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+)
+
+/**
+ * Options est une structure pour stocker les options passées en ligne de commande.
+ * @property {bool} dryRun - Exécute tout le pipeline sans envoyer de notification ni marquer les références comme traitées.
+ * @property {string} dryRunOutput - Fichier dans lequel écrire les messages en mode dry-run (sortie standard si vide).
+ * @property {string} storePath - Fichier JSON où sont conservées les annonces (pas de persistance si vide).
+ * @property {string} httpAddr - Adresse d'écoute de l'API HTTP (API désactivée si vide).
+ * @property {string} configPath - Fichier JSON de configuration.
+ */
+type Options struct {
+	dryRun       bool
+	dryRunOutput string
+	storePath    string
+	httpAddr     string
+	configPath   string
+}
+
+/**
+ * parseOptions lit les options de la ligne de commande.
+ * @param {[]string} args - Les arguments à analyser (sans le nom du programme).
+ * @return {Options} - Les options lues.
+ */
+func parseOptions(args []string) Options {
+	var options Options
+
+	flags := flag.NewFlagSet("agency-scraper", flag.ExitOnError)
+	flags.BoolVar(&options.dryRun, "dry-run", false, "Exécute le scraping sans envoyer de message Telegram ni marquer les annonces comme traitées")
+	flags.StringVar(&options.dryRunOutput, "dry-run-output", "", "Fichier où écrire les messages en mode dry-run (sortie standard par défaut)")
+	flags.StringVar(&options.storePath, "store", "data/store.json", "Fichier JSON où sont conservées les annonces (vide pour ne rien persister)")
+	flags.StringVar(&options.httpAddr, "http-addr", ":8080", "Adresse d'écoute de l'API HTTP (vide pour la désactiver)")
+	flags.StringVar(&options.configPath, "config", "config.json", "Fichier JSON de configuration (profils de recherche...)")
+	flags.Parse(args)
+
+	return options
+}
@@ -2,109 +2,221 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"reflect"
 	"time"
 )
 
 /**
- * RunScraper lance le scraping des annonces immobilières à intervalles réguliers.
+ * RunScraper lance le scraping des annonces immobilières selon la planification de chaque recherche.
  * Cette fonction est appelée depuis le point d'entrée de l'application.
- * @param {int} intervalMinutes - Intervalle de temps en minutes entre chaque cycle de scraping
+ * @param {int} intervalMinutes - Intervalle de temps en minutes entre deux passages des recherches sans planification
+ * @param {Options} options - Les options de la ligne de commande
  * return {void}
  */
-func RunScraper(intervalMinutes int) {
-	// Map globale pour suivre les références des biens déjà traités par les différentes agences
-	processedReferencesAfedim := make(map[string]bool)
-	processedReferencesGiboire := make(map[string]bool)
-	processedReferencesFoncia := make(map[string]bool)
-	processedReferencesAgenceDuColombier := make(map[string]bool)
-	processedReferencesLaFrancaiseImmobiliere := make(map[string]bool)
-	processedReferencesGuenno := make(map[string]bool)
-	processedReferencesLaMotte := make(map[string]bool)
-	processedReferencesKermarrec := make(map[string]bool)
-	processedReferencesNestenn := make(map[string]bool)
-	processedReferencesSquareHabitat := make(map[string]bool)
-	processedReferencesCAImmobilier := make(map[string]bool)
-	processedReferencesPigeaultImmobilier := make(map[string]bool)
-	processedReferencesLaForetImmobilier := make(map[string]bool)
-	processedReferencesCogir := make(map[string]bool)
-
-	for {
-		// Lancer le scraping pour l'agence Afedim
-		processAgencyScraping(processedReferencesAfedim, "https://www.afedim.fr/fr/location/annonces/Appartement-Maison-Parking-Garage/Rennes-France/1-5-pieces/surface-0-100-m2/budget-0-90000-euros/rayon-10-km/disponible-/options-/exclusPlafondRess-/Resultats", "AFEDIM", "Afedim")
-
-		// Lancer le scraping pour l'agence Giboire
-		processAgencyScraping(processedReferencesGiboire, "https://www.giboire.com/recherche-location/appartement/?searchBy=default&address%5B%5D=RENNES&address%5B%5D=CHANTEPIE&address%5B%5D=CESSON+SEVIGNE&priceMax=700&nbBedrooms%5B%5D=1&transactionType%5B%5D=Location&searchBy=default", "GIBOIRE", "Giboire")
-
-		// Lancer le scraping pour l'agence Foncia
-		processAgencyScraping(processedReferencesFoncia, "https://fr.foncia.com/location/rennes-35--chantepie-35135--cesson-sevigne-35510/appartement?nbPiece=2--&prix=--700&advanced=", "FONCIA", "Foncia")
+func RunScraper(intervalMinutes int, options Options) {
+	// Configuration (profils de recherche...)
+	config, err := LoadConfig(options.configPath)
+	if err != nil {
+		log.Fatalf("Erreur lors du chargement de la configuration : %v", err)
+	}
 
-		// Lancer le scraping pour l'agence Agence du Colombier
-		processAgencyScraping(processedReferencesAgenceDuColombier, "https://agenceducolombier.com/annonces/?filter_search_action%5B%5D=louer&filter_search_type%5B%5D=&nb-pieces=&min-chambres=&min-surface=&max-surface=&price_low=0&price_max=6000000&submit=LANCER+MA+RECHERCHE", "AGENCE DU COLOMBIER", "Agence du Colombier")
+	// Canal de notification des nouvelles annonces et des alertes d'administration (Telegram ou dry-run)
+	notifier := NewNotifier(options, config.AdminChatID)
 
-		// Lancer le scraping pour l'agence La Française Immobilière
-		processAgencyScraping(processedReferencesLaFrancaiseImmobiliere, "https://www.la-francaise-immobiliere.fr/location/?post_types=location&categorie%5B%5D=27&zone%5B%5D=6212&zone%5B%5D=6204&zone%5B%5D=6214&nb_chambres_min=0&nb_chambres_max=&prix_min=0&prix_max=700&submitted=1&o=date-desc&action=load_search_results&wia_6_type=&searchOnMap=0&wia_1_reference=", "LA FRANCAISE IMMOBILIERE", "La Française Immobilière")
+	// Store des annonces, partagé entre le scraper et l'API
+	store, err := OpenStore(options.storePath)
+	if err != nil {
+		log.Fatalf("Erreur lors de l'ouverture du store : %v", err)
+	}
 
-		// Lancez le scraping pour l'agence Guenno
-		processAgencyScraping(processedReferencesGuenno, "https://www.guenno.com/biens/recherche?mandate_type=2&realty_type%5B%5D=1&number_room%5B%5D=2&min_surface=&town=RENNES+35000&price_max=700", "GUENNO", "Guenno")
+	// Pool de proxies partagé par toutes les agences, pour conserver la santé des proxies entre les cycles
+	proxies, err := NewProxyPool(config.Proxies)
+	if err != nil {
+		log.Fatalf("Erreur lors de la création du pool de proxies : %v", err)
+	}
 
-		// Lancer le scraping pour l'agence La Motte
-		processAgencyScraping(processedReferencesLaMotte, "https://www.lamotte.fr/location-appartement/ille-et-vilaine/rennes/", "LA MOTTE", "La Motte")
+	// Disjoncteurs des agences en panne ou qui bloquent le scraper, conservés entre les cycles
+	breakers := NewCircuitBreakers(config.CircuitBreaker, notifier)
 
-		// Lancer le scraping pour l'agence Kermarrec
-		processAgencyScraping(processedReferencesKermarrec, "https://www.kermarrec-habitation.fr/location/?post_type=location&false-select=on&99795fbc=&ville%5B%5D=cesson-sevigne-35510&ville%5B%5D=chantepie-35135&ville%5B%5D=rennes-35000&typebien%5B%5D=appartement&budget_max=700&reference=&rayon=0&avec_carte=false&tri=pertinence", "KERMARREC", "Kermarrec")
+	// Contrôle du scraper depuis le dashboard (pauses, relances)
+	control := NewScraperControl()
 
-		// Lancer le scraping pour l'agence Nestenn
-		processAgencyScraping(processedReferencesNestenn, "https://immobilier-rennes-centre.nestenn.com/?action=listing&prestige=0&meuble=0&transaction=louer&list_ville=35+Rennes%2C35135+Chantepie%2C35510+Cesson-S%C3%A9vign%C3%A9&list_type=Appartement&type=Appartement&prix_max=700&pieces=2", "NESTENN", "Nestenn")
+	// Configuration courante, remplacée à chaque rechargement
+	live := NewLiveConfig(options.configPath, config)
 
-		// Lancer le scraping pour l'agence Square Habitat
-		processAgencyScraping(processedReferencesSquareHabitat, "https://www.squarehabitat.fr/annonces/location/bien/appartement/immobilier/bretagne/ille-et-vilaine/rennes-35000", "SQUARE HABITAT", "Square Habitat")
+	// Lancer l'API HTTP en arrière-plan
+	if options.httpAddr != "" {
+		NewAPIServer(store, live, control, proxies, breakers).Start(options.httpAddr)
+	}
 
-		// Lancez le scraping pour l'agence CA Immobilier
-		processAgencyScraping(processedReferencesCAImmobilier, "https://www.ca-immobilier.fr/louer/location/appartement/35/Ille-et-vilaine", "CA IMMOBILIER", "CA Immobilier")
+	// Chaque recherche a sa propre planification, intervalMinutes pour celles qui n'en ont pas
+	fallback := Schedule{Interval: Duration{time.Duration(intervalMinutes) * time.Minute}}
+	scheduler := NewScheduler(config.Searches(), config, fallback, store, time.Now())
+
+	// Recharger la configuration quand le fichier change ou sur SIGHUP, sans perdre le store ni l'état des disjoncteurs
+	live.Watch(func(reloaded *Config) {
+		applyConfig(reloaded, config, scheduler, fallback, breakers, notifier)
+		config = reloaded
+		control.Wake()
+		log.Printf("Configuration %s rechargée", options.configPath)
+	}, func(err error) {
+		log.Printf("Configuration rejetée, la configuration précédente est conservée : %v", err)
+		notifier.NotifyAdmin(fmt.Sprintf("⚠️ Configuration rejetée, la configuration précédente est conservée : %v", err))
+	})
 
-		// Lancer le scraping pour l'agence Pigeault Immobilier
-		processAgencyScraping(processedReferencesPigeaultImmobilier, "https://www.pigeaultimmobilier.com/location/?sous-categorie%5B%5D=1455&agences%5B%5D=26548&prix_min=0&prix_max=700&submitted=1&o=date-desc&action=load_search_results&wia_6_type=location&searchOnMap=0&wia_1_reference=", "PIGEAULT IMMOBILIER", "Pigeault Immobilier")
+	for {
+		// Lancer les recherches dues en parallèle : une agence lente ne retarde pas les autres.
+		// Les recherches d'une même agence passent l'une après l'autre (voir Scheduler.Due)
+		for _, entry := range scheduler.Due(time.Now()) {
+			go func(entry *scheduledSearch) {
+				search := entry.search
+				if control.IsPaused(search.Agency) {
+					fmt.Println("Agence en pause, scraping ignoré :", search.Agency)
+				} else {
+					processAgencyScraping(store, search.URL, search.Title, search.Agency, search.Transaction, live.Get().AgencySettings(search.Agency), proxies, breakers, notifier, options.dryRun)
+				}
+
+				// L'intervalle court à partir de la fin du passage
+				scheduler.Done(entry, time.Now())
+				control.Wake()
+			}(entry)
+		}
 
-		// Lancer le scraping pour l'agence La Foret Immobilier
-		processAgencyScraping(processedReferencesLaForetImmobilier, "https://www.laforet.com/louer/location-appartement?filter%5Btypes%5D=apartment&filter%5Bmax%5D=700&filter%5Bcities%5D=35238%2C35051%2C35055", "LA FORET IMMOBILIER", "La Foret Immobilier")
+		// Attendre le prochain passage dû, la fin d'un passage ou une relance demandée depuis le dashboard
+		for agency := range control.Wait(scheduler.UntilNext(time.Now())) {
+			scheduler.RunNow(agency, time.Now())
+		}
+	}
+}
 
-		// Lancer le scraping pour l'agence Cogir
-		processAgencyScraping(processedReferencesCogir, "https://www.cogir.fr/fr/listing-location.html?loc=location&type%5B%5D=appartement&insee%5B%5D=35051&insee%5B%5D=35055&insee%5B%5D=35238&surfacemin=&prixmax=700&numero=&coordonnees=&archivage_statut=&tri=prix-desc&page=1", "COGIR", "Cogir")
+/**
+ * applyConfig applique une configuration rechargée aux composants du scraper, sans les recréer.
+ * Les recherches sont reconstruites à partir des critères ; les réglages des agences et les profils de recherche
+ * sont lus depuis la configuration courante à chaque utilisation.
+ * @param {*Config} config - La nouvelle configuration.
+ * @param {*Config} previous - La configuration remplacée.
+ * @param {*Scheduler} scheduler - Le planificateur des recherches.
+ * @param {Schedule} fallback - La planification des recherches sans planification configurée.
+ * @param {*CircuitBreakers} breakers - Les disjoncteurs des agences.
+ * @param {Notifier} notifier - Le canal de notification.
+ * @return {void}
+ */
+func applyConfig(config *Config, previous *Config, scheduler *Scheduler, fallback Schedule, breakers *CircuitBreakers, notifier Notifier) {
+	scheduler.Reload(config.Searches(), config, fallback, time.Now())
+	breakers.Configure(config.CircuitBreaker)
+	if telegram, ok := notifier.(*TelegramNotifier); ok {
+		telegram.SetAdminChatID(config.AdminChatID)
+	}
 
-		// Attendre avant le prochain cycle
-		time.Sleep(time.Duration(intervalMinutes) * time.Minute)
+	// Le pool de proxies garde la santé de chaque proxy : il n'est créé qu'au démarrage
+	if !reflect.DeepEqual(config.Proxies, previous.Proxies) {
+		log.Println("La configuration des proxies a changé : redémarrer le scraper pour l'appliquer")
 	}
 }
 
 /**
  * processAgencyScraping lance le scraping pour une agence immobilière spécifique.
- * @param {map[string]bool} processedReferences - Map contenant les références des biens déjà traités.
+ * @param {*Store} store - Le store contenant les annonces déjà connues.
  * @param {string} url - L'URL de la page de l'agence à scraper.
  * @param {string} titleMessageTelegram - Le titre du message Telegram.
  * @param {Agency} nameAgency - Le nom de l'agence.
+ * @param {TransactionType} transaction - Le type de transaction recherché.
+ * @param {AgencySettings} settings - Les réglages HTTP de l'agence.
+ * @param {*ProxyPool} proxies - Le pool de proxies, nil pour des requêtes directes.
+ * @param {*CircuitBreakers} breakers - Les disjoncteurs des agences.
+ * @param {Notifier} notifier - Le canal de notification des nouvelles annonces.
+ * @param {bool} dryRun - Si vrai, les références ne sont pas marquées comme traitées.
  * @return {void}
  */
-func processAgencyScraping(processedReferences map[string]bool, url string, titleMessageTelegram string, nameAgency Agency) {
+func processAgencyScraping(store *Store, url string, titleMessageTelegram string, nameAgency Agency, transaction TransactionType, settings AgencySettings, proxies *ProxyPool, breakers *CircuitBreakers, notifier Notifier, dryRun bool) {
+	// Ignorer l'agence tant que son disjoncteur est ouvert, la tester par une sonde à la fin du temps de repos
+	allowed, probe := breakers.Allow(nameAgency, time.Now())
+	if !allowed {
+		fmt.Printf("Disjoncteur ouvert pour l'agence %s, scraping ignoré jusqu'à %s\n", nameAgency, breakers.RetryAt(nameAgency).Format("15:04"))
+		return
+	}
+
 	// Créer une nouvelle instance de CollyService
-	collyService := NewCollyService()
+	collyService := NewCollyService(nameAgency, settings, proxies)
+	collyService.SetCircuitBreaker(breakers, probe)
+
+	// Ne pas revisiter les pages de détails des annonces connues avant le délai de rafraîchissement
+	collyService.SetKnownListings(store.KnownListings(nameAgency, transaction, settings.DetailRefresh.Duration, time.Now()))
+
+	// Reprendre les annonces du cycle précédent si la page de résultats n'a pas changé (cache HTTP)
+	collyService.SetPreviousListings(store.ActiveListings(nameAgency, transaction))
 
 	// Récupérer les annonces complètes depuis l'agence
 	newAnnouncements := collyService.ScrapeAnnouncement(nameAgency, url)
 
-	// Comparer les références des biens pour détecter les nouvelles annonces
-	for _, announcement := range newAnnouncements {
-		if _, exists := processedReferences[announcement.propertyReference]; !exists {
-			// Nouvelle annonce détectée
-			fmt.Println("Nouvelle annonce détectée référence :", announcement.propertyReference)
-			processedReferences[announcement.propertyReference] = true
-
-			// Envoie un message sur le canal Telegram
-			sendTelegramMessageToPublicChannel(fmt.Sprintf(
-				"%s\nNouvelle annonce immobilière !\nRéférence : %s\nURL : %s",
-				titleMessageTelegram,
-				announcement.propertyReference,
-				announcement.url,
-			))
+	// Normaliser les références pour que la clé d'une annonce ne dépende pas de sa mise en forme
+	newAnnouncements = normalizeAnnouncements(nameAgency, newAnnouncements)
+
+	// Mettre à jour le store et la santé de l'agence
+	now := time.Now()
+	store.RecordRun(nameAgency, len(newAnnouncements), collyService.Errors(), now)
+	tripped := collyService.Tripped()
+	breakers.Record(nameAgency, collyService.Outcome(), probe, now)
+
+	// Un cycle de sonde ou interrompu par le disjoncteur est incomplet : les annonces absentes ne sont pas retirées
+	if probe || tripped {
+		return
+	}
+	// Un cycle dont des pages n'ont pas pu être lues (erreur, nombre maximal de requêtes) ajoute et met à jour
+	// les annonces trouvées, sans retirer les absentes
+	complete := !collyService.Incomplete()
+	if !complete {
+		log.Printf("Cycle incomplet pour l'agence %s : les annonces absentes ne sont pas retirées", nameAgency)
+	}
+	pending := store.Sync(nameAgency, transaction, newAnnouncements, complete, now)
+	store.RecordDetailPages(nameAgency, transaction, collyService.DetailPages(), now)
+
+	// Notifier les annonces qui ne l'ont pas encore été
+	for _, announcement := range pending {
+		// Nouvelle annonce détectée
+		fmt.Println("Nouvelle annonce détectée référence :", announcement.Reference)
+
+		// Envoie un message sur le canal Telegram (ou l'écrit en mode dry-run)
+		notifier.Notify(formatAnnouncementMessage(titleMessageTelegram, announcement))
+
+		// En mode dry-run, la référence n'est pas marquée pour rester "nouvelle" au prochain envoi réel
+		if !dryRun {
+			store.MarkNotified(nameAgency, transaction, announcement.Reference)
+		}
+	}
+}
+
+/**
+ * formatAnnouncementMessage construit le message envoyé pour une nouvelle annonce.
+ * Une vente détaille le prix, les honoraires, les charges de copropriété, le nombre de lots et le DPE quand ils sont connus.
+ * @param {string} titleMessageTelegram - Le titre du message Telegram.
+ * @param {StoredAnnouncement} announcement - L'annonce détectée.
+ * @return {string} - Le message formaté.
+ */
+func formatAnnouncementMessage(titleMessageTelegram string, announcement StoredAnnouncement) string {
+	kind := "à louer"
+	if announcement.Transaction == TransactionSale {
+		kind = "à vendre"
+	}
+	message := fmt.Sprintf("%s\nNouvelle annonce immobilière %s !\nRéférence : %s", titleMessageTelegram, kind, announcement.Reference)
+
+	if announcement.Transaction == TransactionSale {
+		if announcement.Price > 0 {
+			message += "\nPrix : " + formatPrice(announcement.Price)
+			if announcement.AgencyFees > 0 {
+				message += " (dont honoraires " + formatPrice(announcement.AgencyFees) + ")"
+			}
+		}
+		if announcement.CoOwnershipCharges > 0 {
+			message += "\nCharges de copropriété : " + formatPrice(announcement.CoOwnershipCharges) + " / an"
+		}
+		if announcement.Lots > 0 {
+			message += fmt.Sprintf("\nLots : %d", announcement.Lots)
+		}
+		if announcement.EnergyClass != "" {
+			message += "\nDPE : " + announcement.EnergyClass
 		}
 	}
+	return message + "\nURL : " + announcement.URL
 }
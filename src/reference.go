@@ -0,0 +1,227 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Version des règles de normalisation des références.
+// À incrémenter quand une règle change : les clés du store sont alors recalculées à l'ouverture.
+const ReferenceRulesVersion = 1
+
+// Préfixe retiré des références quand l'agence n'a pas de règle spécifique ("Réf :", "Référence du bien :", "(ref :"...)
+var referencePrefixPattern = regexp.MustCompile(`(?i)^\(?\s*(?:r[ée]f(?:[ée]rence)?(?:\s+(?:du\s+bien|de\s+l'annonce|annonce|agence|web|mandat))?|mandat|n°)(?:\s*n°)?(?:\s*[.:#]\s*:?\s*|\s+)`)
+
+// Règles d'extraction des références propres à chaque agence, essayées dans l'ordre
+var referenceRules = map[Agency][]*regexp.Regexp{
+	// La Foret affiche une référence web et une référence agence : la référence web est commune à tout le réseau
+	LaForetImmobilier: {
+		regexp.MustCompile(`(?i)web\s*:?\s*([^,]*)`),
+		regexp.MustCompile(`(?i)agence\s*:?\s*([^,]*)`),
+	},
+	// Nestenn fait précéder la référence d'autres informations du bien dans le même bloc
+	Nestenn: {
+		regexp.MustCompile(`(?i)r[ée]f\s*:\s*(.+)$`),
+	},
+	// La Motte identifie ses biens par un numéro de lot
+	LaMotte: {
+		regexp.MustCompile(`(?i)^lot\s*(?:n°)?\s*:?\s*(.*)$`),
+	},
+}
+
+// Expression régulière pour trouver un identifiant numérique dans une URL
+var urlIDPattern = regexp.MustCompile(`\d{4,}`)
+
+/**
+ * normalizeReference extrait et normalise la référence d'une annonce à partir du texte de la page :
+ * règle propre à l'agence ou préfixe "Réf :" générique, espaces et ponctuation retirés aux extrémités, majuscules.
+ * Un texte sans règle ni préfixe est gardé tel quel, nettoyé : c'est le cas des références déjà normalisées du store.
+ * La normalisation est idempotente : une référence déjà normalisée reste identique.
+ * @param {Agency} agency - L'agence.
+ * @param {string} raw - Le texte contenant la référence (ex: "Réf : ab 123.").
+ * @return {string} - La référence normalisée (ex: "AB 123"), vide si introuvable.
+ */
+func normalizeReference(agency Agency, raw string) string {
+	if reference, ok := extractReference(agency, raw); ok {
+		return reference
+	}
+	return cleanReference(strings.Join(strings.Fields(raw), " "))
+}
+
+/**
+ * extractReference extrait la référence du texte d'un élément de page de détails, seulement si la règle de l'agence
+ * ou un préfixe de référence ("Réf :", "Référence du bien :", "Lot"...) y correspond : un élément qui n'est pas
+ * une référence (ex: "TVA 5,5 %") n'est pas pris pour une annonce.
+ * @param {Agency} agency - L'agence.
+ * @param {string} raw - Le texte de l'élément.
+ * @return {string} - La référence normalisée.
+ * @return {bool} - Faux si le texte ne contient pas de référence.
+ */
+func extractReference(agency Agency, raw string) (string, bool) {
+	raw = strings.Join(strings.Fields(raw), " ")
+
+	for _, rule := range referenceRules[agency] {
+		if match := rule.FindStringSubmatch(raw); match != nil {
+			if reference := cleanReference(match[1]); reference != "" {
+				return reference, true
+			}
+		}
+	}
+
+	if loc := referencePrefixPattern.FindStringIndex(raw); loc != nil {
+		reference := cleanReference(raw[loc[1]:])
+		return reference, reference != ""
+	}
+	return "", false
+}
+
+/**
+ * cleanReference retire la ponctuation aux extrémités d'une référence et la met en majuscules.
+ * @param {string} reference - La référence.
+ * @return {string} - La référence nettoyée.
+ */
+func cleanReference(reference string) string {
+	return strings.ToUpper(strings.Trim(strings.Join(strings.Fields(reference), " "), " .,;:#()[]-_/"))
+}
+
+/**
+ * referenceFromURL construit une référence à partir de l'URL de l'annonce, pour les annonces sans référence.
+ * L'identifiant numérique le plus à droite du chemin est privilégié, sinon le dernier segment du chemin.
+ * @param {string} rawURL - L'URL de l'annonce.
+ * @return {string} - La référence préfixée par "URL-", vide si l'URL est inexploitable.
+ */
+func referenceFromURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Path == "" {
+		return ""
+	}
+
+	if ids := urlIDPattern.FindAllString(parsed.Path, -1); len(ids) > 0 {
+		return "URL-" + ids[len(ids)-1]
+	}
+
+	segment := strings.TrimSuffix(path.Base(strings.TrimSuffix(parsed.Path, "/")), path.Ext(parsed.Path))
+	if reference := cleanReference(segment); reference != "" && reference != "." {
+		return "URL-" + reference
+	}
+	return ""
+}
+
+/**
+ * canonicalReference retourne la référence canonique d'une annonce : sa référence normalisée,
+ * ou à défaut un identifiant tiré de son URL.
+ * @param {Agency} agency - L'agence.
+ * @param {string} reference - La référence extraite par le scraper.
+ * @param {string} rawURL - L'URL de l'annonce.
+ * @return {string} - La référence canonique, vide si l'annonce n'est pas identifiable.
+ */
+func canonicalReference(agency Agency, reference string, rawURL string) string {
+	if normalized := normalizeReference(agency, reference); normalized != "" {
+		return normalized
+	}
+	return referenceFromURL(rawURL)
+}
+
+/**
+ * normalizeAnnouncements remplace la référence des annonces scrapées par leur référence canonique.
+ * Les annonces sans référence ni URL exploitable sont ignorées.
+ * @param {Agency} agency - L'agence.
+ * @param {[]Announcement} announcements - Les annonces scrapées.
+ * @return {[]Announcement} - Les annonces avec leur référence canonique.
+ */
+func normalizeAnnouncements(agency Agency, announcements []Announcement) []Announcement {
+	normalized := make([]Announcement, 0, len(announcements))
+	for _, announcement := range announcements {
+		reference := canonicalReference(agency, announcement.propertyReference, announcement.url)
+		if reference == "" {
+			log.Printf("Annonce ignorée, aucune référence ni URL exploitable : %q %s", announcement.propertyReference, announcement.url)
+			continue
+		}
+		announcement.propertyReference = reference
+		normalized = append(normalized, announcement)
+	}
+	return normalized
+}
+
+/**
+ * migrateReferencesLocked recalcule les références et les clés des annonces après un changement des règles
+ * de normalisation, ainsi que celles des pages de détails connues. Les annonces qui obtiennent la même clé
+ * sont fusionnées. Le verrou doit être détenu.
+ * @return {int} - Le nombre d'annonces dont la clé a changé.
+ */
+func (store *Store) migrateReferencesLocked() int {
+	migrated := make(map[string]*StoredAnnouncement, len(store.announcements))
+	changed := 0
+
+	// Parcourir les clés dans l'ordre pour que la fusion soit déterministe
+	keys := make([]string, 0, len(store.announcements))
+	for key := range store.announcements {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		stored := store.announcements[key]
+		if reference := canonicalReference(stored.Agency, stored.Reference, stored.URL); reference != "" && reference != stored.Reference {
+			stored.Reference = reference
+			changed++
+		}
+
+		newKey := stored.key()
+		if existing, exists := migrated[newKey]; exists {
+			migrated[newKey] = mergeStoredAnnouncements(existing, stored)
+		} else {
+			migrated[newKey] = stored
+		}
+	}
+
+	store.announcements = migrated
+
+	// Les pages de détails connues pointent vers les nouvelles références
+	for url, entry := range store.detailURLs {
+		if reference := canonicalReference(entry.Agency, entry.Reference, url); reference != "" {
+			entry.Reference = reference
+		}
+	}
+	return changed
+}
+
+/**
+ * mergeStoredAnnouncements fusionne deux annonces stockées devenues identiques après migration.
+ * L'annonce vue le plus récemment sert de base, avec la première apparition et l'historique des deux.
+ * @param {*StoredAnnouncement} a - La première annonce.
+ * @param {*StoredAnnouncement} b - La seconde annonce.
+ * @return {*StoredAnnouncement} - L'annonce fusionnée.
+ */
+func mergeStoredAnnouncements(a *StoredAnnouncement, b *StoredAnnouncement) *StoredAnnouncement {
+	merged, other := a, b
+	if b.LastSeen.After(a.LastSeen) {
+		merged, other = b, a
+	}
+
+	if other.FirstSeen.Before(merged.FirstSeen) {
+		merged.FirstSeen = other.FirstSeen
+	}
+	merged.Notified = merged.Notified || other.Notified
+	history := append(merged.History, other.History...)
+	sort.SliceStable(history, func(i, j int) bool { return history[i].Time.Before(history[j].Time) })
+
+	// Une seule première apparition : la plus ancienne
+	merged.History = history[:0]
+	firstSeen := false
+	for _, event := range history {
+		if event.Type == EventFirstSeen {
+			if firstSeen {
+				continue
+			}
+			firstSeen = true
+		}
+		merged.History = append(merged.History, event)
+	}
+
+	return merged
+}
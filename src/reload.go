@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fréquence de vérification des modifications du fichier de configuration
+const configWatchInterval = 5 * time.Second
+
+/**
+ * LiveConfig est la configuration courante du scraper, rechargée quand le fichier change ou à la réception de SIGHUP.
+ * Une configuration invalide est rejetée : la configuration précédente reste en place.
+ * @property {sync.RWMutex} mu - Verrou protégeant la configuration.
+ * @property {string} path - Chemin du fichier JSON (aucun rechargement si vide).
+ * @property {*Config} config - La configuration courante.
+ * @property {time.Time} modTime - Date de modification du fichier au dernier chargement.
+ * @property {int64} size - Taille du fichier au dernier chargement.
+ */
+type LiveConfig struct {
+	mu      sync.RWMutex
+	path    string
+	config  *Config
+	modTime time.Time
+	size    int64
+}
+
+/**
+ * NewLiveConfig crée la configuration courante à partir de la configuration chargée au démarrage.
+ * @param {string} path - Chemin du fichier JSON.
+ * @param {*Config} config - La configuration chargée au démarrage.
+ * @return {*LiveConfig} - La configuration courante.
+ */
+func NewLiveConfig(path string, config *Config) *LiveConfig {
+	live := &LiveConfig{path: path, config: config}
+	if info, err := os.Stat(path); err == nil {
+		live.modTime, live.size = info.ModTime(), info.Size()
+	}
+	return live
+}
+
+/**
+ * Get retourne la configuration courante. Elle ne doit pas être modifiée : un rechargement la remplace.
+ * @return {*Config} - La configuration.
+ */
+func (live *LiveConfig) Get() *Config {
+	live.mu.RLock()
+	defer live.mu.RUnlock()
+
+	return live.config
+}
+
+/**
+ * changed indique si le fichier de configuration a été modifié depuis le dernier chargement.
+ * @return {bool} - Vrai si la date de modification ou la taille du fichier a changé.
+ */
+func (live *LiveConfig) changed() bool {
+	info, err := os.Stat(live.path)
+	if err != nil {
+		return false
+	}
+
+	live.mu.RLock()
+	defer live.mu.RUnlock()
+
+	return !info.ModTime().Equal(live.modTime) || info.Size() != live.size
+}
+
+/**
+ * Reload relit et valide le fichier de configuration, puis remplace la configuration courante.
+ * @return {*Config} - La nouvelle configuration.
+ * @return {error} - Erreur si le fichier est absent, illisible ou invalide : la configuration courante est gardée.
+ */
+func (live *LiveConfig) Reload() (*Config, error) {
+	info, err := os.Stat(live.path)
+	if err != nil {
+		// LoadConfig accepte un fichier absent, pas le rechargement : ce serait repartir d'une configuration vide
+		return nil, fmt.Errorf("lecture de la configuration %s : %w", live.path, err)
+	}
+
+	// Le fichier est marqué comme lu même s'il est invalide, pour ne pas répéter l'erreur à chaque vérification
+	live.mu.Lock()
+	live.modTime, live.size = info.ModTime(), info.Size()
+	live.mu.Unlock()
+
+	config, err := LoadConfig(live.path)
+	if err != nil {
+		return nil, err
+	}
+
+	live.mu.Lock()
+	live.config = config
+	live.mu.Unlock()
+	return config, nil
+}
+
+/**
+ * Watch recharge la configuration en arrière-plan quand le fichier change ou à la réception de SIGHUP.
+ * @param {func(*Config)} onReload - Appelée avec la nouvelle configuration après un rechargement réussi.
+ * @param {func(error)} onError - Appelée quand la nouvelle configuration est rejetée.
+ * @return {void}
+ */
+func (live *LiveConfig) Watch(onReload func(*Config), onError func(error)) {
+	if live.path == "" {
+		return
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	ticker := time.NewTicker(configWatchInterval)
+
+	go func() {
+		for {
+			select {
+			case <-hangup:
+				log.Printf("SIGHUP reçu : rechargement de la configuration %s", live.path)
+			case <-ticker.C:
+				if !live.changed() {
+					continue
+				}
+				log.Printf("Fichier de configuration %s modifié : rechargement", live.path)
+			}
+
+			config, err := live.Reload()
+			if err != nil {
+				onError(err)
+				continue
+			}
+			onReload(config)
+		}
+	}()
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // Fuseaux horaires embarqués : l'image Docker alpine n'en fournit pas
+)
+
+// Fuseau horaire par défaut des heures actives et des expressions cron
+const DefaultTimezone = "Europe/Paris"
+
+/**
+ * Schedule est la planification d'une recherche : un intervalle avec une variation aléatoire, ou une expression cron,
+ * éventuellement limités à des heures actives.
+ * @property {Duration} Interval - Attente entre la fin d'un passage et le suivant (ex: "1m").
+ * @property {Duration} Jitter - Attente aléatoire supplémentaire, jusqu'à cette durée, pour ne pas passer à heure fixe.
+ * @property {string} Cron - Expression cron à cinq champs (ex: "*\/2 8-19 * * 1-5"), à la place de l'intervalle.
+ * @property {string} ActiveHours - Plage horaire des passages (ex: "08:00-20:00", "22:00-06:00"), toute la journée si vide.
+ * @property {*AdaptivePolling} Adaptive - Adapte l'intervalle aux heures de publication observées, dans ces bornes.
+ * @property {*CronExpression} cron - L'expression cron lue.
+ * @property {[2]int} active - Début et fin des heures actives, en minutes depuis minuit.
+ */
+type Schedule struct {
+	Interval    Duration `json:"interval,omitempty"`
+	Jitter      Duration `json:"jitter,omitempty"`
+	Cron        string   `json:"cron,omitempty"`
+	ActiveHours string   `json:"activeHours,omitempty"`
+
+	Adaptive *AdaptivePolling `json:"adaptive,omitempty"`
+
+	cron   *CronExpression
+	active *[2]int
+}
+
+/**
+ * Validate vérifie la planification et lit l'expression cron et les heures actives.
+ * @return {error} - La première erreur trouvée.
+ */
+func (schedule *Schedule) Validate() error {
+	switch {
+	case schedule.Interval.Duration < 0:
+		return fmt.Errorf("interval négatif : %s", schedule.Interval)
+	case schedule.Jitter.Duration < 0:
+		return fmt.Errorf("jitter négatif : %s", schedule.Jitter)
+	case schedule.Cron != "" && schedule.Interval.Duration > 0:
+		return fmt.Errorf("interval et cron ne peuvent pas être utilisés ensemble")
+	}
+
+	if schedule.Cron != "" {
+		cron, err := ParseCron(schedule.Cron)
+		if err != nil {
+			return err
+		}
+		if cron.Next(time.Now()).IsZero() {
+			return fmt.Errorf("expression cron %q : aucune date ne correspond", schedule.Cron)
+		}
+		schedule.cron = cron
+	}
+	if schedule.Adaptive != nil {
+		if schedule.Cron != "" {
+			return fmt.Errorf("adaptive ne s'applique qu'à un intervalle, pas à une expression cron")
+		}
+		if err := schedule.Adaptive.Validate(); err != nil {
+			return err
+		}
+	}
+	if schedule.ActiveHours != "" {
+		active, err := parseActiveHours(schedule.ActiveHours)
+		if err != nil {
+			return err
+		}
+		schedule.active = &active
+	}
+	return nil
+}
+
+/**
+ * parseActiveHours lit une plage horaire "HH:MM-HH:MM".
+ * @param {string} hours - La plage horaire.
+ * @return {[2]int} - Début et fin de la plage, en minutes depuis minuit.
+ * @return {error} - Erreur si la plage est invalide.
+ */
+func parseActiveHours(hours string) ([2]int, error) {
+	var active [2]int
+	from, to, found := strings.Cut(hours, "-")
+	if !found {
+		return active, fmt.Errorf("activeHours invalide %q (ex: \"08:00-20:00\")", hours)
+	}
+	for i, value := range []string{from, to} {
+		parsed, err := time.Parse("15:04", strings.TrimSpace(value))
+		if err != nil {
+			return active, fmt.Errorf("activeHours invalide %q (ex: \"08:00-20:00\")", hours)
+		}
+		active[i] = parsed.Hour()*60 + parsed.Minute()
+	}
+	if active[0] == active[1] {
+		return active, fmt.Errorf("activeHours vide %q", hours)
+	}
+	return active, nil
+}
+
+/**
+ * isActive indique si une date est dans les heures actives.
+ * @param {time.Time} t - La date, dans le fuseau des heures actives.
+ * @return {bool} - Vrai si la date est dans les heures actives.
+ */
+func (schedule *Schedule) isActive(t time.Time) bool {
+	if schedule.active == nil {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	from, to := schedule.active[0], schedule.active[1]
+	if from < to {
+		return minute >= from && minute < to
+	}
+	// Plage qui passe minuit (ex: 22:00-06:00)
+	return minute >= from || minute < to
+}
+
+/**
+ * nextActiveStart retourne le prochain début des heures actives après une date.
+ * @param {time.Time} t - La date, dans le fuseau des heures actives.
+ * @return {time.Time} - Le début des heures actives.
+ */
+func (schedule *Schedule) nextActiveStart(t time.Time) time.Time {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, schedule.active[0], 0, 0, t.Location())
+	if !start.After(t) {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start
+}
+
+/**
+ * Next retourne la date du prochain passage après la fin d'un passage.
+ * @param {time.Time} after - La fin du passage, dans le fuseau des heures actives.
+ * @param {*rand.Rand} random - Le générateur pour la variation aléatoire.
+ * @return {time.Time} - La date du prochain passage.
+ */
+func (schedule *Schedule) Next(after time.Time, random *rand.Rand) time.Time {
+	next := after
+	if schedule.cron != nil {
+		next = schedule.cron.Next(after)
+		// Chercher la première date de l'expression dans les heures actives
+		for i := 0; i < 1000 && !next.IsZero() && !schedule.isActive(next); i++ {
+			next = schedule.cron.Next(schedule.nextActiveStart(next).Add(-time.Minute))
+		}
+	} else {
+		next = next.Add(schedule.Interval.Duration)
+		if !schedule.isActive(next) {
+			next = schedule.nextActiveStart(next)
+		}
+	}
+
+	if schedule.Jitter.Duration > 0 {
+		next = next.Add(time.Duration(random.Int63n(int64(schedule.Jitter.Duration))))
+	}
+	return next
+}
+
+/**
+ * First retourne la date du premier passage : immédiat pendant les heures actives, sinon au début des prochaines.
+ * Avec une expression cron, le premier passage est la première date de l'expression, minute courante comprise.
+ * @param {time.Time} now - La date de démarrage, dans le fuseau des heures actives.
+ * @param {*rand.Rand} random - Le générateur pour la variation aléatoire.
+ * @return {time.Time} - La date du premier passage.
+ */
+func (schedule *Schedule) First(now time.Time, random *rand.Rand) time.Time {
+	if schedule.cron != nil {
+		return schedule.Next(now.Add(-time.Minute), random)
+	}
+	if schedule.isActive(now) {
+		return now
+	}
+	return schedule.nextActiveStart(now)
+}
+
+/**
+ * Equal indique si deux planifications ont les mêmes réglages.
+ * @param {Schedule} other - L'autre planification.
+ * @return {bool} - Vrai si les réglages sont identiques.
+ */
+func (schedule Schedule) Equal(other Schedule) bool {
+	if schedule.Interval != other.Interval || schedule.Jitter != other.Jitter ||
+		schedule.Cron != other.Cron || schedule.ActiveHours != other.ActiveHours {
+		return false
+	}
+	if schedule.Adaptive == nil || other.Adaptive == nil {
+		return schedule.Adaptive == other.Adaptive
+	}
+	return *schedule.Adaptive == *other.Adaptive
+}
+
+/**
+ * Schedule retourne la planification d'une agence : celle de la configuration, sinon la planification par défaut.
+ * @param {Agency} agency - L'agence.
+ * @param {Schedule} fallback - La planification utilisée si ni l'agence ni defaultSchedule n'en ont.
+ * @return {Schedule} - La planification, prête à l'emploi.
+ */
+func (config *Config) Schedule(agency Agency, fallback Schedule) Schedule {
+	schedule := fallback
+	if config.DefaultSchedule != nil {
+		schedule = *config.DefaultSchedule
+	}
+	for name, configured := range config.Schedules {
+		if found, exists := findAgency(name); exists && found == agency {
+			schedule = configured
+		}
+	}
+	// Des heures actives ou une variation sans intervalle ni cron gardent l'intervalle par défaut
+	if schedule.Interval.Duration == 0 && schedule.Cron == "" {
+		schedule.Interval = fallback.Interval
+	}
+
+	// La configuration a été validée au chargement : seule l'expression cron et les heures actives sont lues ici
+	if err := schedule.Validate(); err != nil {
+		log.Printf("Planification de l'agence %s invalide, planification par défaut utilisée : %v", agency, err)
+		schedule = fallback
+	}
+	return schedule
+}
+
+/**
+ * Location retourne le fuseau horaire des heures actives et des expressions cron.
+ * @return {*time.Location} - Le fuseau horaire.
+ */
+func (config *Config) Location() *time.Location {
+	name := config.Timezone
+	if name == "" {
+		name = DefaultTimezone
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return location
+}
+
+/**
+ * scheduledSearch est une recherche planifiée.
+ * @property {Search} search - La recherche.
+ * @property {Schedule} schedule - Sa planification.
+ * @property {time.Time} next - La date du prochain passage.
+ * @property {bool} running - Vrai pendant un passage.
+ * @property {bool} rescan - Vrai si un nouveau passage a été demandé pendant le passage en cours.
+ * @property {*pollingPlan} plan - Les intervalles adaptatifs par créneau horaire, nil tant que l'historique est insuffisant.
+ * @property {time.Time} planAt - Date du dernier calcul des intervalles adaptatifs.
+ */
+type scheduledSearch struct {
+	search   Search
+	schedule Schedule
+	next     time.Time
+	running  bool
+	rescan   bool
+	plan     *pollingPlan
+	planAt   time.Time
+}
+
+/**
+ * Scheduler lance chaque recherche selon sa propre planification : un passage long ne retarde pas les autres agences.
+ * @property {sync.Mutex} mu - Verrou protégeant les recherches planifiées.
+ * @property {[]*scheduledSearch} searches - Les recherches planifiées.
+ * @property {*time.Location} location - Le fuseau horaire des heures actives et des expressions cron.
+ * @property {*rand.Rand} random - Générateur pour la variation aléatoire.
+ * @property {*Store} store - Le store, dont les dates d'apparition des annonces règlent les intervalles adaptatifs.
+ */
+type Scheduler struct {
+	mu       sync.Mutex
+	searches []*scheduledSearch
+	location *time.Location
+	random   *rand.Rand
+	store    *Store
+}
+
+/**
+ * NewScheduler planifie les recherches. Le premier passage de chaque recherche est immédiat pendant ses heures actives.
+ * @param {[]Search} searches - Les recherches.
+ * @param {*Config} config - La configuration (planifications par agence, fuseau horaire).
+ * @param {Schedule} fallback - La planification des recherches sans planification configurée.
+ * @param {*Store} store - Le store des annonces, pour les intervalles adaptatifs.
+ * @param {time.Time} now - La date de démarrage.
+ * @return {*Scheduler} - Le planificateur.
+ */
+func NewScheduler(searches []Search, config *Config, fallback Schedule, store *Store, now time.Time) *Scheduler {
+	scheduler := &Scheduler{
+		location: config.Location(),
+		random:   rand.New(rand.NewSource(now.UnixNano())),
+		store:    store,
+	}
+	for _, search := range searches {
+		schedule := config.Schedule(search.Agency, fallback)
+		scheduler.searches = append(scheduler.searches, &scheduledSearch{
+			search:   search,
+			schedule: schedule,
+			next:     schedule.First(now.In(scheduler.location), scheduler.random),
+		})
+	}
+	return scheduler
+}
+
+/**
+ * Reload remplace les recherches et leurs planifications, au rechargement de la configuration.
+ * Une recherche déjà planifiée (même agence, même URL) garde son prochain passage tant que sa planification
+ * ne change pas ; sinon elle est replanifiée comme au démarrage. Une recherche en cours termine son passage.
+ * @param {[]Search} searches - Les recherches.
+ * @param {*Config} config - La nouvelle configuration.
+ * @param {Schedule} fallback - La planification des recherches sans planification configurée.
+ * @param {time.Time} now - La date du rechargement.
+ * @return {void}
+ */
+func (scheduler *Scheduler) Reload(searches []Search, config *Config, fallback Schedule, now time.Time) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	existing := make(map[Search]*scheduledSearch)
+	for _, entry := range scheduler.searches {
+		existing[Search{Agency: entry.search.Agency, URL: entry.search.URL}] = entry
+	}
+
+	scheduler.location = config.Location()
+	var reloaded []*scheduledSearch
+	for _, search := range searches {
+		schedule := config.Schedule(search.Agency, fallback)
+		entry, exists := existing[Search{Agency: search.Agency, URL: search.URL}]
+		if !exists {
+			entry = &scheduledSearch{schedule: schedule, next: schedule.First(now.In(scheduler.location), scheduler.random)}
+		} else if !entry.schedule.Equal(schedule) {
+			entry.schedule = schedule
+			entry.plan, entry.planAt = nil, time.Time{}
+			if !entry.running {
+				entry.next = schedule.First(now.In(scheduler.location), scheduler.random)
+			}
+		}
+		entry.search = search
+		reloaded = append(reloaded, entry)
+	}
+	scheduler.searches = reloaded
+}
+
+/**
+ * Due retourne les recherches dont le passage est dû, et les marque en cours.
+ * Les recherches d'une même agence ne tournent jamais en même temps (session, cookies et disjoncteur partagés) :
+ * une recherche due attend la fin du passage en cours pour son agence.
+ * @param {time.Time} now - La date courante.
+ * @return {[]*scheduledSearch} - Les recherches à lancer.
+ */
+func (scheduler *Scheduler) Due(now time.Time) []*scheduledSearch {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	// Par agence libre, lancer la recherche due depuis le plus longtemps
+	busy := scheduler.busyAgenciesLocked()
+	oldest := make(map[Agency]*scheduledSearch)
+	var agencies []Agency
+	for _, entry := range scheduler.searches {
+		agency := entry.search.Agency
+		if entry.running || busy[agency] || entry.next.After(now) {
+			continue
+		}
+		if current, exists := oldest[agency]; !exists {
+			agencies = append(agencies, agency)
+			oldest[agency] = entry
+		} else if entry.next.Before(current.next) {
+			oldest[agency] = entry
+		}
+	}
+	var due []*scheduledSearch
+	for _, agency := range agencies {
+		entry := oldest[agency]
+		entry.running = true
+		due = append(due, entry)
+	}
+	return due
+}
+
+/**
+ * busyAgenciesLocked retourne les agences dont une recherche est en cours. Le verrou doit être détenu.
+ * @return {map[Agency]bool} - Les agences occupées.
+ */
+func (scheduler *Scheduler) busyAgenciesLocked() map[Agency]bool {
+	busy := make(map[Agency]bool)
+	for _, entry := range scheduler.searches {
+		if entry.running {
+			busy[entry.search.Agency] = true
+		}
+	}
+	return busy
+}
+
+/**
+ * Done planifie le passage suivant d'une recherche, à partir de la fin du passage.
+ * @param {*scheduledSearch} entry - La recherche.
+ * @param {time.Time} now - La fin du passage.
+ * @return {void}
+ */
+func (scheduler *Scheduler) Done(entry *scheduledSearch, now time.Time) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	entry.running = false
+	if entry.rescan {
+		entry.rescan = false
+		entry.next = now
+		return
+	}
+	schedule := entry.schedule
+	if plan := scheduler.pollingPlanLocked(entry, now); plan != nil {
+		schedule.Interval = Duration{plan.wait(now.In(scheduler.location))}
+	}
+	entry.next = schedule.Next(now.In(scheduler.location), scheduler.random)
+}
+
+/**
+ * pollingPlanLocked retourne les intervalles adaptatifs d'une recherche, recalculés toutes les heures
+ * à partir des dates d'apparition des annonces de l'agence. Le verrou doit être détenu.
+ * @param {*scheduledSearch} entry - La recherche.
+ * @param {time.Time} now - La date courante.
+ * @return {*pollingPlan} - Les intervalles, nil si la recherche n'est pas adaptative ou si l'historique est insuffisant.
+ */
+func (scheduler *Scheduler) pollingPlanLocked(entry *scheduledSearch, now time.Time) *pollingPlan {
+	adaptive := entry.schedule.Adaptive
+	if adaptive == nil || scheduler.store == nil {
+		return nil
+	}
+	if !entry.planAt.IsZero() && now.Sub(entry.planAt) < adaptivePlanRefresh {
+		return entry.plan
+	}
+
+	weeks := adaptive.LookbackWeeks
+	if weeks == 0 {
+		weeks = DefaultAdaptiveLookbackWeeks
+	}
+	counts, total := scheduler.store.PublicationCounts(entry.search.Agency, entry.search.Transaction, scheduler.location, now.AddDate(0, 0, -7*weeks))
+	entry.planAt = now
+	entry.plan = nil
+	if total < adaptiveMinObservations {
+		return nil
+	}
+
+	entry.plan = newPollingPlan(counts, entry.schedule.Interval.Duration, *adaptive)
+	shortest, longest := entry.plan.bounds()
+	log.Printf("Intervalle adaptatif de l'agence %s : de %s à %s (%d nouvelle(s) annonce(s) sur %d semaine(s))", entry.search.Agency, shortest, longest, total, weeks)
+	return entry.plan
+}
+
+/**
+ * RunNow avance le passage des recherches d'une agence, demandé depuis le dashboard.
+ * Une recherche en cours est relancée dès la fin de son passage.
+ * @param {Agency} agency - L'agence.
+ * @param {time.Time} now - La date de la demande.
+ * @return {void}
+ */
+func (scheduler *Scheduler) RunNow(agency Agency, now time.Time) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	for _, entry := range scheduler.searches {
+		if entry.search.Agency != agency {
+			continue
+		}
+		if entry.running {
+			entry.rescan = true
+		} else {
+			entry.next = now
+		}
+	}
+}
+
+/**
+ * UntilNext retourne l'attente jusqu'au prochain passage dû, parmi les recherches qui ne sont pas en cours
+ * et dont l'agence n'est pas occupée par une autre recherche.
+ * @param {time.Time} now - La date courante.
+ * @return {time.Duration} - L'attente, une heure si toutes les recherches sont en cours (la fin d'un passage réveille la boucle).
+ */
+func (scheduler *Scheduler) UntilNext(now time.Time) time.Duration {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	busy := scheduler.busyAgenciesLocked()
+	wait := time.Hour
+	for _, entry := range scheduler.searches {
+		if !entry.running && !busy[entry.search.Agency] && entry.next.Sub(now) < wait {
+			wait = entry.next.Sub(now)
+		}
+	}
+	return max(wait, 0)
+}
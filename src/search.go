@@ -0,0 +1,676 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Search est une recherche à scraper sur le site d'une agence.
+ * @property {Agency} Agency - L'agence.
+ * @property {string} Title - Le titre du message Telegram.
+ * @property {string} URL - L'URL de la page de résultats de l'agence.
+ * @property {TransactionType} Transaction - Le type de transaction recherché.
+ */
+type Search struct {
+	Agency      Agency
+	Title       string
+	URL         string
+	Transaction TransactionType
+}
+
+/**
+ * TransactionType est le type de transaction recherché.
+ */
+type TransactionType string
+
+// Types de transaction
+const (
+	TransactionRent TransactionType = "location"
+	TransactionSale TransactionType = "vente"
+)
+
+/**
+ * PropertyType est un type de bien recherché.
+ */
+type PropertyType string
+
+// Types de bien
+const (
+	PropertyApartment PropertyType = "appartement"
+	PropertyHouse     PropertyType = "maison"
+	PropertyParking   PropertyType = "parking"
+)
+
+/**
+ * SearchCriteria sont les critères d'une recherche, traduits dans l'URL de recherche de chaque agence.
+ * Les critères qu'un site ne sait pas filtrer sont ignorés pour ce site ; les critères à zéro ne filtrent pas.
+ * @property {TransactionType} Transaction - Le type de transaction (défaut : location).
+ * @property {[]PropertyType} PropertyTypes - Les types de bien (défaut : tous). Un site qui n'en accepte qu'un utilise le premier.
+ * @property {[]string} Cities - Les communes, par nom, code postal ou code INSEE. Un site qui n'en accepte qu'une utilise la première.
+ * @property {float64} MaxRent - Le loyer maximal, charges comprises (location uniquement).
+ * @property {float64} MaxPrice - Le prix maximal, honoraires inclus (vente uniquement).
+ * @property {float64} MinSurface - La surface minimale, en m².
+ * @property {int} MinRooms - Le nombre minimal de pièces.
+ * @property {[]Agency} Agencies - Les agences interrogées (défaut : toutes). Chacune doit pouvoir lancer la recherche.
+ */
+type SearchCriteria struct {
+	Transaction   TransactionType `json:"transaction,omitempty"`
+	PropertyTypes []PropertyType  `json:"propertyTypes,omitempty"`
+	Cities        []string        `json:"cities"`
+	MaxRent       float64         `json:"maxRent,omitempty"`
+	MaxPrice      float64         `json:"maxPrice,omitempty"`
+	MinSurface    float64         `json:"minSurface,omitempty"`
+	MinRooms      int             `json:"minRooms,omitempty"`
+	Agencies      []Agency        `json:"agencies,omitempty"`
+}
+
+/**
+ * DefaultSearchCriteria sont les critères utilisés si la configuration n'en définit pas :
+ * un appartement de 2 pièces ou plus à Rennes, Chantepie ou Cesson-Sévigné, pour 700 € maximum.
+ */
+var DefaultSearchCriteria = SearchCriteria{
+	Transaction:   TransactionRent,
+	PropertyTypes: []PropertyType{PropertyApartment},
+	Cities:        []string{"Rennes", "Chantepie", "Cesson-Sévigné"},
+	MaxRent:       700,
+	MinRooms:      2,
+}
+
+/**
+ * Validate vérifie les critères, que chaque commune est connue et que chaque agence interrogée peut lancer la recherche
+ * (une agence sans recherche de ventes doit être retirée de la liste des agences plutôt qu'ignorée).
+ * @param {[]Commune} extra - Les communes de la configuration, en plus des communes connues.
+ * @return {error} - La première erreur trouvée.
+ */
+func (criteria SearchCriteria) Validate(extra []Commune) error {
+	switch criteria.Transaction {
+	case "", TransactionRent, TransactionSale:
+	default:
+		return fmt.Errorf("search : transaction inconnue %q (location ou vente)", criteria.Transaction)
+	}
+	for _, propertyType := range criteria.PropertyTypes {
+		switch propertyType {
+		case PropertyApartment, PropertyHouse, PropertyParking:
+		default:
+			return fmt.Errorf("search : type de bien inconnu %q (appartement, maison ou parking)", propertyType)
+		}
+	}
+	switch {
+	case len(criteria.Cities) == 0:
+		return fmt.Errorf("search : aucune commune")
+	case criteria.MaxRent < 0:
+		return fmt.Errorf("search : maxRent négatif : %v", criteria.MaxRent)
+	case criteria.MaxPrice < 0:
+		return fmt.Errorf("search : maxPrice négatif : %v", criteria.MaxPrice)
+	case !criteria.isRent() && criteria.MaxRent != 0:
+		return fmt.Errorf("search : maxRent ne s'applique qu'aux locations, utiliser maxPrice pour une vente")
+	case criteria.isRent() && criteria.MaxPrice != 0:
+		return fmt.Errorf("search : maxPrice ne s'applique qu'aux ventes, utiliser maxRent pour une location")
+	case criteria.MinSurface < 0:
+		return fmt.Errorf("search : minSurface négatif : %v", criteria.MinSurface)
+	case criteria.MinRooms < 0:
+		return fmt.Errorf("search : minRooms négatif : %d", criteria.MinRooms)
+	}
+	for _, name := range criteria.Agencies {
+		if _, exists := findAgency(string(name)); !exists {
+			return fmt.Errorf("search : agence inconnue %q", name)
+		}
+	}
+
+	communes, err := resolveCommunes(criteria.Cities, extra)
+	if err != nil {
+		return fmt.Errorf("search : %w", err)
+	}
+	for _, agency := range criteria.agencies() {
+		if _, err := buildSearchURL(agency, criteria, communes); err != nil {
+			return fmt.Errorf("search : recherche %s impossible pour l'agence %s (à retirer de agencies) : %w", criteria.transaction(), agency, err)
+		}
+	}
+	return nil
+}
+
+/**
+ * agencies retourne les agences interrogées par la recherche, toutes par défaut.
+ * @return {[]Agency} - Les agences.
+ */
+func (criteria SearchCriteria) agencies() []Agency {
+	if len(criteria.Agencies) == 0 {
+		return AllAgencies
+	}
+	agencies := make([]Agency, 0, len(criteria.Agencies))
+	for _, name := range criteria.Agencies {
+		if agency, exists := findAgency(string(name)); exists {
+			agencies = append(agencies, agency)
+		}
+	}
+	return agencies
+}
+
+/**
+ * transaction retourne le type de transaction, location par défaut.
+ * @return {TransactionType} - Le type de transaction.
+ */
+func (criteria SearchCriteria) transaction() TransactionType {
+	if criteria.Transaction == "" {
+		return TransactionRent
+	}
+	return criteria.Transaction
+}
+
+/**
+ * isRent indique si la recherche porte sur des locations.
+ * @return {bool} - Vrai pour une location.
+ */
+func (criteria SearchCriteria) isRent() bool {
+	return criteria.transaction() == TransactionRent
+}
+
+/**
+ * maxBudget retourne le montant maximal de la recherche : le loyer pour une location, le prix pour une vente.
+ * @return {float64} - Le montant maximal, zéro s'il ne filtre pas.
+ */
+func (criteria SearchCriteria) maxBudget() float64 {
+	if criteria.isRent() {
+		return criteria.MaxRent
+	}
+	return criteria.MaxPrice
+}
+
+/**
+ * firstPropertyType retourne le premier type de bien, pour les sites qui n'en acceptent qu'un.
+ * @return {PropertyType} - Le type de bien, vide si la recherche porte sur tous les types.
+ */
+func (criteria SearchCriteria) firstPropertyType() PropertyType {
+	if len(criteria.PropertyTypes) == 0 {
+		return ""
+	}
+	return criteria.PropertyTypes[0]
+}
+
+/**
+ * minBedrooms retourne le nombre minimal de chambres, pour les sites qui filtrent par chambres : un T2 a une chambre.
+ * @return {int} - Le nombre de chambres.
+ */
+func (criteria SearchCriteria) minBedrooms() int {
+	return max(criteria.MinRooms-1, 0)
+}
+
+/**
+ * propertyLabels traduit les types de bien dans le vocabulaire d'un site. Les types inconnus du site sont ignorés.
+ * @param {map[PropertyType]string} labels - Le libellé de chaque type de bien sur le site.
+ * @return {[]string} - Les libellés.
+ */
+func (criteria SearchCriteria) propertyLabels(labels map[PropertyType]string) []string {
+	var values []string
+	for _, propertyType := range criteria.PropertyTypes {
+		if label, exists := labels[propertyType]; exists {
+			values = append(values, label)
+		}
+	}
+	return values
+}
+
+/**
+ * formatAmount écrit un montant ou une surface sans décimales inutiles, vide si zéro.
+ * @param {float64} amount - Le montant.
+ * @return {string} - Le montant écrit.
+ */
+func formatAmount(amount float64) string {
+	if amount == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+/**
+ * formatCount écrit un nombre, vide si zéro.
+ * @param {int} count - Le nombre.
+ * @return {string} - Le nombre écrit.
+ */
+func formatCount(count int) string {
+	if count == 0 {
+		return ""
+	}
+	return strconv.Itoa(count)
+}
+
+/**
+ * communeDepartment retourne le département de la première commune, pour les sites dont l'URL le contient.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {Commune} - La première commune.
+ * @return {Department} - Son département.
+ * @return {error} - Erreur si le département est inconnu.
+ */
+func communeDepartment(communes []Commune) (Commune, Department, error) {
+	commune := communes[0]
+	department, exists := commune.Department()
+	if !exists {
+		return commune, Department{}, fmt.Errorf("département %s inconnu", commune.DepartmentCode())
+	}
+	return commune, department, nil
+}
+
+/**
+ * pathSlug écrit un nom dans les chemins d'URL (minuscules, sans accents, tirets).
+ * @param {string} name - Le nom.
+ * @return {string} - Le nom écrit.
+ */
+func pathSlug(name string) string {
+	return slugReplacer.Replace(strings.ToLower(name))
+}
+
+/**
+ * searchURLAfedim construit l'URL de recherche de l'agence Afedim, dont les critères sont des segments du chemin.
+ * La recherche porte sur un rayon de 10 km autour de la première commune. Afedim ne propose que des locations.
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Erreur si la recherche n'est pas possible sur le site.
+ */
+func searchURLAfedim(criteria SearchCriteria, communes []Commune) (string, error) {
+	if !criteria.isRent() {
+		return "", fmt.Errorf("Afedim ne propose que des locations")
+	}
+	types := criteria.propertyLabels(map[PropertyType]string{PropertyApartment: "Appartement", PropertyHouse: "Maison", PropertyParking: "Parking-Garage"})
+	if len(types) == 0 {
+		types = []string{"Appartement", "Maison", "Parking-Garage"}
+	}
+	// Bornes hautes des curseurs du site
+	minRooms, maxRooms := max(criteria.MinRooms, 1), 5
+	minSurface, maxSurface := int(criteria.MinSurface), 100
+	budget := criteria.maxBudget()
+	if budget == 0 {
+		budget = 90000
+	}
+
+	return fmt.Sprintf(
+		"https://www.afedim.fr/fr/location/annonces/%s/%s-France/%d-%d-pieces/surface-%d-%d-m2/budget-0-%s-euros/rayon-10-km/disponible-/options-/exclusPlafondRess-/Resultats",
+		strings.Join(types, "-"), url.PathEscape(communes[0].Name), minRooms, max(minRooms, maxRooms), minSurface, max(minSurface, maxSurface), formatAmount(budget),
+	), nil
+}
+
+/**
+ * searchURLGiboire construit l'URL de recherche de l'agence Giboire, qui filtre par nombre de chambres.
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Toujours nil.
+ */
+func searchURLGiboire(criteria SearchCriteria, communes []Commune) (string, error) {
+	path, transaction := "recherche-location", "Location"
+	if !criteria.isRent() {
+		path, transaction = "recherche-vente", "Vente"
+	}
+	if propertyType := criteria.firstPropertyType(); propertyType != "" {
+		path += "/" + string(propertyType)
+	}
+
+	query := url.Values{"searchBy": {"default"}, "transactionType[]": {transaction}}
+	for _, commune := range communes {
+		query.Add("address[]", commune.UpperName())
+	}
+	if criteria.maxBudget() > 0 {
+		query.Set("priceMax", formatAmount(criteria.maxBudget()))
+	}
+	if bedrooms := criteria.minBedrooms(); bedrooms > 0 {
+		query.Set("nbBedrooms[]", strconv.Itoa(bedrooms))
+	}
+	return "https://www.giboire.com/" + path + "/?" + query.Encode(), nil
+}
+
+/**
+ * searchURLFoncia construit l'URL de recherche de l'agence Foncia. Les communes à plusieurs codes postaux
+ * sont désignées par leur département (ex: rennes-35).
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Toujours nil.
+ */
+func searchURLFoncia(criteria SearchCriteria, communes []Commune) (string, error) {
+	transaction := "location"
+	if !criteria.isRent() {
+		transaction = "achat"
+	}
+	var places []string
+	for _, commune := range communes {
+		code := commune.PostalCode()
+		if len(commune.PostalCodes) > 1 {
+			code = commune.DepartmentCode()
+		}
+		places = append(places, commune.Slug()+"-"+code)
+	}
+	path := transaction + "/" + strings.Join(places, "--")
+	if types := criteria.propertyLabels(map[PropertyType]string{PropertyApartment: "appartement", PropertyHouse: "maison", PropertyParking: "parking"}); len(types) > 0 {
+		path += "/" + strings.Join(types, "--")
+	}
+
+	// Les plages s'écrivent min--max, une borne vide ne filtre pas
+	query := url.Values{"advanced": {""}}
+	if criteria.MinRooms > 0 {
+		query.Set("nbPiece", strconv.Itoa(criteria.MinRooms)+"--")
+	}
+	if criteria.maxBudget() > 0 {
+		query.Set("prix", "--"+formatAmount(criteria.maxBudget()))
+	}
+	if criteria.MinSurface > 0 {
+		query.Set("surface", formatAmount(criteria.MinSurface)+"--")
+	}
+	return "https://fr.foncia.com/" + path + "?" + query.Encode(), nil
+}
+
+/**
+ * searchURLGuenno construit l'URL de recherche de l'agence Guenno, qui n'accepte qu'une commune.
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Toujours nil.
+ */
+func searchURLGuenno(criteria SearchCriteria, communes []Commune) (string, error) {
+	mandateType := "2"
+	if !criteria.isRent() {
+		mandateType = "1"
+	}
+	commune := communes[0]
+	query := url.Values{
+		"mandate_type": {mandateType},
+		"town":         {commune.UpperName() + " " + commune.PostalCode()},
+		"min_surface":  {formatAmount(criteria.MinSurface)},
+		"price_max":    {formatAmount(criteria.maxBudget())},
+	}
+	query["realty_type[]"] = criteria.propertyLabels(map[PropertyType]string{PropertyApartment: "1"})
+	if criteria.MinRooms > 0 {
+		// Cases à cocher du nombre de pièces, de 1 à 5 et plus
+		for rooms := min(criteria.MinRooms, 5); rooms <= 5; rooms++ {
+			query.Add("number_room[]", strconv.Itoa(rooms))
+		}
+	}
+	return "https://www.guenno.com/biens/recherche?" + query.Encode(), nil
+}
+
+/**
+ * searchURLLaMotte construit l'URL de recherche de l'agence La Motte, par commune et type de bien dans le chemin.
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Erreur si le département de la commune est inconnu.
+ */
+func searchURLLaMotte(criteria SearchCriteria, communes []Commune) (string, error) {
+	commune, department, err := communeDepartment(communes)
+	if err != nil {
+		return "", err
+	}
+	path := string(criteria.transaction())
+	if propertyType := criteria.firstPropertyType(); propertyType != "" {
+		path += "-" + string(propertyType)
+	}
+	return fmt.Sprintf("https://www.lamotte.fr/%s/%s/%s/", path, pathSlug(department.Name), commune.Slug()), nil
+}
+
+/**
+ * searchURLKermarrec construit l'URL de recherche de l'agence Kermarrec, avec les communes écrites nom-codepostal.
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Toujours nil.
+ */
+func searchURLKermarrec(criteria SearchCriteria, communes []Commune) (string, error) {
+	transaction := string(criteria.transaction())
+	query := url.Values{
+		"post_type":  {transaction},
+		"budget_max": {formatAmount(criteria.maxBudget())},
+		"rayon":      {"0"},
+		"avec_carte": {"false"},
+		"tri":        {"pertinence"},
+	}
+	for _, commune := range communes {
+		query.Add("ville[]", commune.Slug()+"-"+commune.PostalCode())
+	}
+	query["typebien[]"] = criteria.propertyLabels(map[PropertyType]string{PropertyApartment: "appartement", PropertyHouse: "maison", PropertyParking: "parking"})
+	return "https://www.kermarrec-habitation.fr/" + transaction + "/?" + query.Encode(), nil
+}
+
+/**
+ * searchURLNestenn construit l'URL de recherche de l'agence Nestenn. Les communes à plusieurs codes postaux
+ * sont désignées par leur département (ex: "35 Rennes").
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Toujours nil.
+ */
+func searchURLNestenn(criteria SearchCriteria, communes []Commune) (string, error) {
+	transaction := "louer"
+	if !criteria.isRent() {
+		transaction = "acheter"
+	}
+	var places []string
+	for _, commune := range communes {
+		code := commune.PostalCode()
+		if len(commune.PostalCodes) > 1 {
+			code = commune.DepartmentCode()
+		}
+		places = append(places, code+" "+commune.Name)
+	}
+	types := criteria.propertyLabels(map[PropertyType]string{PropertyApartment: "Appartement", PropertyHouse: "Maison", PropertyParking: "Parking"})
+
+	query := url.Values{
+		"action":      {"listing"},
+		"prestige":    {"0"},
+		"meuble":      {"0"},
+		"transaction": {transaction},
+		"list_ville":  {strings.Join(places, ",")},
+		"list_type":   {strings.Join(types, ",")},
+		"prix_max":    {formatAmount(criteria.maxBudget())},
+		"pieces":      {formatCount(criteria.MinRooms)},
+	}
+	if len(types) > 0 {
+		query.Set("type", types[0])
+	}
+	return "https://immobilier-rennes-centre.nestenn.com/?" + query.Encode(), nil
+}
+
+/**
+ * searchURLSquareHabitat construit l'URL de recherche de l'agence Square Habitat, par région, département
+ * et commune dans le chemin.
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Erreur si le département de la commune est inconnu.
+ */
+func searchURLSquareHabitat(criteria SearchCriteria, communes []Commune) (string, error) {
+	commune, department, err := communeDepartment(communes)
+	if err != nil {
+		return "", err
+	}
+	path := string(criteria.transaction())
+	if propertyType := criteria.firstPropertyType(); propertyType != "" {
+		path += "/bien/" + string(propertyType)
+	}
+	return fmt.Sprintf(
+		"https://www.squarehabitat.fr/annonces/%s/immobilier/%s/%s/%s-%s",
+		path, pathSlug(department.Region), pathSlug(department.Name), commune.Slug(), commune.PostalCode(),
+	), nil
+}
+
+/**
+ * searchURLCAImmobilier construit l'URL de recherche de l'agence CA Immobilier, qui recherche par département.
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Erreur si le département de la commune est inconnu.
+ */
+func searchURLCAImmobilier(criteria SearchCriteria, communes []Commune) (string, error) {
+	commune, department, err := communeDepartment(communes)
+	if err != nil {
+		return "", err
+	}
+	path := "louer/location"
+	if !criteria.isRent() {
+		path = "acheter/achat"
+	}
+	if propertyType := criteria.firstPropertyType(); propertyType != "" {
+		path += "/" + string(propertyType)
+	}
+	// Le site n'écrit en majuscule que la première lettre du département (ex: Ille-et-vilaine)
+	name := pathSlug(department.Name)
+	return fmt.Sprintf("https://www.ca-immobilier.fr/%s/%s/%s", path, commune.DepartmentCode(), strings.ToUpper(name[:1])+name[1:]), nil
+}
+
+/**
+ * searchURLLaForetImmobilier construit l'URL de recherche de l'agence La Forêt, qui désigne les communes par leur code INSEE.
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Toujours nil.
+ */
+func searchURLLaForetImmobilier(criteria SearchCriteria, communes []Commune) (string, error) {
+	path := "louer/location"
+	if !criteria.isRent() {
+		path = "acheter/achat"
+	}
+	if propertyType := criteria.firstPropertyType(); propertyType != "" {
+		path += "-" + string(propertyType)
+	}
+
+	var codes []string
+	for _, commune := range communes {
+		codes = append(codes, commune.INSEE)
+	}
+	query := url.Values{"filter[cities]": {strings.Join(codes, ",")}}
+	if types := criteria.propertyLabels(map[PropertyType]string{PropertyApartment: "apartment", PropertyHouse: "house"}); len(types) > 0 {
+		query.Set("filter[types]", strings.Join(types, ","))
+	}
+	if criteria.maxBudget() > 0 {
+		query.Set("filter[max]", formatAmount(criteria.maxBudget()))
+	}
+	return "https://www.laforet.com/" + path + "?" + query.Encode(), nil
+}
+
+/**
+ * searchURLCogir construit l'URL de recherche de l'agence Cogir, qui désigne les communes par leur code INSEE.
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Toujours nil.
+ */
+func searchURLCogir(criteria SearchCriteria, communes []Commune) (string, error) {
+	transaction := string(criteria.transaction())
+	query := url.Values{
+		"loc":        {transaction},
+		"surfacemin": {formatAmount(criteria.MinSurface)},
+		"prixmax":    {formatAmount(criteria.maxBudget())},
+		"tri":        {"prix-desc"},
+		"page":       {"1"},
+	}
+	for _, commune := range communes {
+		query.Add("insee[]", commune.INSEE)
+	}
+	query["type[]"] = criteria.propertyLabels(map[PropertyType]string{PropertyApartment: "appartement", PropertyHouse: "maison", PropertyParking: "parking"})
+	return "https://www.cogir.fr/fr/listing-" + transaction + ".html?" + query.Encode(), nil
+}
+
+/**
+ * buildSearchURL construit l'URL de recherche d'une agence à partir des critères.
+ * @param {Agency} agency - L'agence.
+ * @param {SearchCriteria} criteria - Les critères.
+ * @param {[]Commune} communes - Les communes de la recherche, déjà résolues.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Erreur si la recherche n'est pas possible sur le site de l'agence.
+ */
+func buildSearchURL(agency Agency, criteria SearchCriteria, communes []Commune) (string, error) {
+	if adapter, exists := wiaAdapters[agency]; exists {
+		return adapter.SearchURL(criteria)
+	}
+	if adapter, exists := wpEstateAdapters[agency]; exists {
+		return adapter.SearchURL(criteria)
+	}
+
+	switch agency {
+	case Afedim:
+		return searchURLAfedim(criteria, communes)
+	case Giboire:
+		return searchURLGiboire(criteria, communes)
+	case Foncia:
+		return searchURLFoncia(criteria, communes)
+	case Guenno:
+		return searchURLGuenno(criteria, communes)
+	case LaMotte:
+		return searchURLLaMotte(criteria, communes)
+	case Kermarrec:
+		return searchURLKermarrec(criteria, communes)
+	case Nestenn:
+		return searchURLNestenn(criteria, communes)
+	case SquareHabitat:
+		return searchURLSquareHabitat(criteria, communes)
+	case CAImmobilier:
+		return searchURLCAImmobilier(criteria, communes)
+	case LaForetImmobilier:
+		return searchURLLaForetImmobilier(criteria, communes)
+	case Cogir:
+		return searchURLCogir(criteria, communes)
+	}
+	return "", fmt.Errorf("aucune URL de recherche pour l'agence %s", agency)
+}
+
+/**
+ * searchTitle retourne le titre des messages d'une agence (ex: "LA FRANCAISE IMMOBILIERE"),
+ * suivi de la transaction pour les ventes (ex: "FONCIA - VENTE").
+ * @param {Agency} agency - L'agence.
+ * @param {TransactionType} transaction - Le type de transaction.
+ * @return {string} - Le titre.
+ */
+func searchTitle(agency Agency, transaction TransactionType) string {
+	title := strings.ToUpper(strings.ReplaceAll(agency.Slug(), "-", " "))
+	if transaction == TransactionSale {
+		title += " - VENTE"
+	}
+	return title
+}
+
+/**
+ * searchCriteria retourne les critères de recherche de la configuration : search puis searches,
+ * ou DefaultSearchCriteria si aucun.
+ * @return {[]SearchCriteria} - Les critères.
+ */
+func (config *Config) searchCriteria() []SearchCriteria {
+	var criteria []SearchCriteria
+	if config.Search != nil {
+		criteria = append(criteria, *config.Search)
+	}
+	criteria = append(criteria, config.SearchList...)
+	if len(criteria) == 0 {
+		criteria = append(criteria, DefaultSearchCriteria)
+	}
+	return criteria
+}
+
+/**
+ * Searches retourne les recherches de chaque agence, construites à partir des critères de la configuration
+ * (DefaultSearchCriteria si aucun). Les critères sont validés au chargement : chaque agence interrogée peut lancer sa recherche.
+ * @return {[]Search} - Les recherches.
+ */
+func (config *Config) Searches() []Search {
+	var searches []Search
+	for _, criteria := range config.searchCriteria() {
+		communes, err := resolveCommunes(criteria.Cities, config.Communes)
+		if err != nil {
+			// La configuration a été validée au chargement : seules les communes par défaut peuvent échouer ici
+			log.Printf("Critères de recherche invalides : %v", err)
+			continue
+		}
+
+		transaction := criteria.transaction()
+		for _, agency := range criteria.agencies() {
+			searchURL, err := buildSearchURL(agency, criteria, communes)
+			if err != nil {
+				log.Printf("Recherche %s ignorée pour l'agence %s : %v", transaction, agency, err)
+				continue
+			}
+			searches = append(searches, Search{Agency: agency, Title: searchTitle(agency, transaction), URL: searchURL, Transaction: transaction})
+		}
+	}
+	return searches
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Valeurs par défaut des sessions des agences
+const (
+	DefaultSessionDir    = "data/sessions"
+	DefaultSessionMaxAge = 12 * time.Hour
+)
+
+/**
+ * SessionConfig décrit l'initialisation de la session d'une agence, pour les sites qui n'affichent tous
+ * les résultats qu'après l'acceptation des cookies ou avec un cookie de session d'une première visite.
+ * @property {string} WarmupURL - La page visitée pour obtenir les cookies de session (ex: la page d'accueil).
+ * @property {string} ConsentURL - L'adresse du formulaire de consentement, envoyé après la première visite (facultatif).
+ * @property {map[string]string} ConsentForm - Les champs du formulaire de consentement.
+ * @property {[]string} RequiredCookies - Les cookies attendus : la session est renouvelée si l'un d'eux manque ou a expiré.
+ * @property {Duration} MaxAge - Durée de vie de la session avant son renouvellement (défaut : 12 heures).
+ */
+type SessionConfig struct {
+	WarmupURL       string            `json:"warmupURL"`
+	ConsentURL      string            `json:"consentURL,omitempty"`
+	ConsentForm     map[string]string `json:"consentForm,omitempty"`
+	RequiredCookies []string          `json:"requiredCookies,omitempty"`
+	MaxAge          Duration          `json:"maxAge,omitempty"`
+}
+
+/**
+ * savedCookie est un cookie conservé sur disque avec l'URL qui l'a déposé.
+ */
+type savedCookie struct {
+	URL    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+/**
+ * sessionFile est le format du fichier de session d'une agence.
+ */
+type sessionFile struct {
+	StartedAt time.Time     `json:"started_at"`
+	Cookies   []savedCookie `json:"cookies"`
+}
+
+/**
+ * SessionJar est un cookie jar persistant : les cookies reçus sont écrits sur disque et rechargés au cycle suivant.
+ * @property {sync.Mutex} mu - Verrou protégeant les cookies conservés.
+ * @property {*cookiejar.Jar} jar - Le cookie jar de la bibliothèque standard, qui applique les règles des cookies.
+ * @property {string} path - Le fichier de la session.
+ * @property {time.Time} startedAt - Date d'initialisation de la session.
+ * @property {map[string]savedCookie} cookies - Les cookies conservés, indexés par site, nom, domaine et chemin.
+ */
+type SessionJar struct {
+	mu        sync.Mutex
+	jar       *cookiejar.Jar
+	path      string
+	startedAt time.Time
+	cookies   map[string]savedCookie
+}
+
+/**
+ * Validate vérifie les adresses de la session.
+ * @return {error} - La première erreur trouvée.
+ */
+func (config SessionConfig) Validate() error {
+	for _, rawURL := range []string{config.WarmupURL, config.ConsentURL} {
+		if rawURL == "" {
+			continue
+		}
+		if parsed, err := url.Parse(rawURL); err != nil || parsed.Host == "" {
+			return fmt.Errorf("session : adresse invalide %q", rawURL)
+		}
+	}
+	if config.WarmupURL == "" {
+		return fmt.Errorf("session : warmupURL manquante")
+	}
+	if config.MaxAge.Duration < 0 {
+		return fmt.Errorf("session : maxAge négatif : %s", config.MaxAge)
+	}
+	return nil
+}
+
+/**
+ * OpenSessionJar ouvre le cookie jar persistant d'une agence et recharge les cookies encore valides.
+ * @param {string} dir - Le dossier des sessions.
+ * @param {Agency} agency - L'agence.
+ * @return {*SessionJar} - Le cookie jar.
+ */
+func OpenSessionJar(dir string, agency Agency) *SessionJar {
+	jar, _ := cookiejar.New(nil)
+	sessionJar := &SessionJar{
+		jar:     jar,
+		path:    filepath.Join(dir, agency.Slug()+".json"),
+		cookies: make(map[string]savedCookie),
+	}
+
+	data, err := os.ReadFile(sessionJar.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Lecture de la session de l'agence %s impossible : %v", agency, err)
+		}
+		return sessionJar
+	}
+
+	var file sessionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		log.Printf("Session de l'agence %s illisible, une nouvelle session sera créée : %v", agency, err)
+		return sessionJar
+	}
+
+	now := time.Now()
+	sessionJar.startedAt = file.StartedAt
+	for _, saved := range file.Cookies {
+		parsed, err := url.Parse(saved.URL)
+		if err != nil || saved.Cookie == nil || (!saved.Cookie.Expires.IsZero() && saved.Cookie.Expires.Before(now)) {
+			continue
+		}
+		jar.SetCookies(parsed, []*http.Cookie{saved.Cookie})
+		sessionJar.cookies[cookieKey(parsed, saved.Cookie)] = saved
+	}
+	return sessionJar
+}
+
+/**
+ * cookieKey retourne la clé d'un cookie conservé.
+ * @param {*url.URL} u - L'URL qui a déposé le cookie.
+ * @param {*http.Cookie} cookie - Le cookie.
+ * @return {string} - La clé.
+ */
+func cookieKey(u *url.URL, cookie *http.Cookie) string {
+	return u.Host + "|" + cookie.Name + "|" + cookie.Domain + "|" + cookie.Path
+}
+
+/**
+ * SetCookies enregistre les cookies reçus d'un site et les écrit sur disque.
+ * @param {*url.URL} u - L'URL de la réponse.
+ * @param {[]*http.Cookie} cookies - Les cookies reçus.
+ * @return {void}
+ */
+func (sessionJar *SessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	sessionJar.mu.Lock()
+	defer sessionJar.mu.Unlock()
+
+	sessionJar.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+	origin := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+	for _, cookie := range cookies {
+		key := cookieKey(u, cookie)
+		if cookie.MaxAge < 0 || (!cookie.Expires.IsZero() && cookie.Expires.Before(now)) {
+			delete(sessionJar.cookies, key)
+			continue
+		}
+		// Max-Age est converti en date d'expiration pour rester valable après rechargement
+		saved := *cookie
+		if saved.MaxAge > 0 {
+			saved.Expires = now.Add(time.Duration(saved.MaxAge) * time.Second)
+			saved.MaxAge = 0
+		}
+		saved.Raw = ""
+		sessionJar.cookies[key] = savedCookie{URL: origin.String(), Cookie: &saved}
+	}
+	sessionJar.saveLocked()
+}
+
+/**
+ * Cookies retourne les cookies à envoyer à une URL.
+ * @param {*url.URL} u - L'URL de la requête.
+ * @return {[]*http.Cookie} - Les cookies.
+ */
+func (sessionJar *SessionJar) Cookies(u *url.URL) []*http.Cookie {
+	sessionJar.mu.Lock()
+	jar := sessionJar.jar
+	sessionJar.mu.Unlock()
+
+	return jar.Cookies(u)
+}
+
+/**
+ * NeedsRefresh indique si la session doit être renouvelée : jamais initialisée, trop ancienne,
+ * ou sans l'un des cookies attendus.
+ * @param {SessionConfig} config - La configuration de la session.
+ * @return {bool} - Vrai si la session doit être renouvelée.
+ */
+func (sessionJar *SessionJar) NeedsRefresh(config SessionConfig) bool {
+	sessionJar.mu.Lock()
+	startedAt := sessionJar.startedAt
+	sessionJar.mu.Unlock()
+
+	maxAge := config.MaxAge.Duration
+	if maxAge == 0 {
+		maxAge = DefaultSessionMaxAge
+	}
+	if startedAt.IsZero() || time.Since(startedAt) >= maxAge {
+		return true
+	}
+
+	warmupURL, err := url.Parse(config.WarmupURL)
+	if err != nil {
+		return true
+	}
+	present := make(map[string]bool)
+	for _, cookie := range sessionJar.Cookies(warmupURL) {
+		present[cookie.Name] = true
+	}
+	for _, name := range config.RequiredCookies {
+		if !present[name] {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Reset oublie les cookies de la session avant son renouvellement.
+ * @return {void}
+ */
+func (sessionJar *SessionJar) Reset() {
+	sessionJar.mu.Lock()
+	defer sessionJar.mu.Unlock()
+
+	sessionJar.jar, _ = cookiejar.New(nil)
+	sessionJar.cookies = make(map[string]savedCookie)
+	sessionJar.startedAt = time.Time{}
+	sessionJar.saveLocked()
+}
+
+/**
+ * MarkStarted enregistre la date d'initialisation de la session.
+ * @param {time.Time} now - La date d'initialisation.
+ * @return {void}
+ */
+func (sessionJar *SessionJar) MarkStarted(now time.Time) {
+	sessionJar.mu.Lock()
+	defer sessionJar.mu.Unlock()
+
+	sessionJar.startedAt = now
+	sessionJar.saveLocked()
+}
+
+/**
+ * saveLocked écrit la session sur disque, de façon atomique. Le verrou doit être détenu.
+ * @return {void}
+ */
+func (sessionJar *SessionJar) saveLocked() {
+	file := sessionFile{StartedAt: sessionJar.startedAt, Cookies: make([]savedCookie, 0, len(sessionJar.cookies))}
+	for _, saved := range sessionJar.cookies {
+		file.Cookies = append(file.Cookies, saved)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(sessionJar.path), 0o700)
+	}
+	if err == nil {
+		err = os.WriteFile(sessionJar.path+".tmp", data, 0o600)
+	}
+	if err == nil {
+		err = os.Rename(sessionJar.path+".tmp", sessionJar.path)
+	}
+	if err != nil {
+		log.Printf("Écriture de la session %s impossible : %v", sessionJar.path, err)
+	}
+}
+
+/**
+ * ensureSession initialise ou renouvelle la session de l'agence avant le scraping : visite de la page
+ * d'amorçage, puis envoi du formulaire de consentement s'il est configuré.
+ * @return {void}
+ */
+func (collyService *CollyService) ensureSession() {
+	config := collyService.settings.Session
+	if config == nil || collyService.jar == nil || !collyService.jar.NeedsRefresh(*config) {
+		return
+	}
+
+	fmt.Println("Initialisation de la session de l'agence :", collyService.agency)
+	collyService.jar.Reset()
+
+	// Collecteur synchrone avec les mêmes réglages, en-têtes et proxies que le scraping
+	bootstrap := colly.NewCollector(colly.IgnoreRobotsTxt())
+	collyService.applySettings(bootstrap)
+
+	failed := false
+	bootstrap.OnError(func(_ *colly.Response, err error) {
+		err = fmt.Errorf("initialisation de la session : %w", describeTLSError(err))
+		log.Printf("Erreur pendant l'initialisation de la session de l'agence %s : %v", collyService.agency, err)
+		collyService.recordError(err)
+		failed = true
+	})
+
+	// Le collecteur est synchrone : les erreurs de requête sont passées à OnError avant le retour de Visit et Post
+	if err := bootstrap.Visit(config.WarmupURL); err != nil {
+		failed = true
+	}
+	if config.ConsentURL != "" && !failed {
+		if err := bootstrap.Post(config.ConsentURL, config.ConsentForm); err != nil {
+			failed = true
+		}
+	}
+
+	// Une session incomplète est retentée au prochain cycle
+	if !failed {
+		collyService.jar.MarkStarted(time.Now())
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+/**
+ * Duration est une durée lue depuis la configuration, écrite "2s", "1m30s" ou en secondes (2).
+ */
+type Duration struct {
+	time.Duration
+}
+
+/**
+ * UnmarshalJSON lit une durée au format Go ("2s") ou un nombre de secondes.
+ * @param {[]byte} data - La valeur JSON.
+ * @return {error} - Erreur si la durée est invalide.
+ */
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch typed := value.(type) {
+	case float64:
+		duration.Duration = time.Duration(typed * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(typed)
+		if err != nil {
+			return fmt.Errorf("durée invalide %q (ex: \"2s\", \"1m30s\")", typed)
+		}
+		duration.Duration = parsed
+	default:
+		return fmt.Errorf("durée invalide : %s", data)
+	}
+	return nil
+}
+
+/**
+ * MarshalJSON écrit la durée au format Go ("2s").
+ * @return {[]byte} - La valeur JSON.
+ * @return {error} - Toujours nil.
+ */
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(duration.String())
+}
+
+/**
+ * AgencySettings contient les réglages de politesse HTTP d'une agence, appliqués au collecteur
+ * de la page de résultats et à celui des pages de détails. Les valeurs à zéro gardent le réglage par défaut.
+ * @property {int} Parallelism - Nombre maximal de requêtes simultanées.
+ * @property {Duration} Delay - Attente entre deux requêtes.
+ * @property {Duration} RandomDelay - Attente aléatoire supplémentaire, jusqu'à cette durée.
+ * @property {Duration} Timeout - Délai maximal d'une requête.
+ * @property {int} MaxRequests - Nombre maximal de requêtes par cycle (0 = illimité).
+ * @property {Duration} DetailRefresh - Délai avant de revisiter la page de détails d'une annonce déjà connue.
+ * @property {bool} InsecureSkipVerify - Désactive la vérification des certificats TLS du site (à éviter).
+ * @property {string} CAFile - Fichier PEM d'autorités de certification ajoutées à celles du système.
+ * @property {string} HeaderProfile - Le profil d'en-têtes imposé à l'agence (tiré au hasard à chaque session si vide).
+ * @property {RequestOptions} Requests - Le traitement des requêtes (cache, en-têtes, Referer, cookies, réécritures), complète celui déclaré pour l'agence.
+ * @property {*SessionConfig} Session - L'initialisation de la session (page d'amorçage, consentement), aucune si nil.
+ * @property {bool} HTTPCache - Met en cache les pages de résultats et les revalide par des requêtes conditionnelles.
+ * @property {[]HeaderProfile} headerProfiles - Les profils d'en-têtes de la configuration (profils par défaut si vide).
+ * @property {string} httpCacheDir - Le dossier du cache HTTP.
+ * @property {string} sessionDir - Le dossier des sessions.
+ */
+type AgencySettings struct {
+	Parallelism int      `json:"parallelism,omitempty"`
+	Delay       Duration `json:"delay,omitempty"`
+	RandomDelay Duration `json:"randomDelay,omitempty"`
+	Timeout     Duration `json:"timeout,omitempty"`
+	MaxRequests int      `json:"maxRequests,omitempty"`
+
+	DetailRefresh Duration `json:"detailRefresh,omitempty"`
+
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	CAFile             string `json:"caFile,omitempty"`
+
+	HeaderProfile  string         `json:"headerProfile,omitempty"`
+	Requests       RequestOptions `json:"requests,omitempty"`
+	HTTPCache      bool           `json:"httpCache,omitempty"`
+	Session        *SessionConfig `json:"session,omitempty"`
+	headerProfiles []HeaderProfile
+	httpCacheDir   string
+	sessionDir     string
+}
+
+/**
+ * DefaultAgencySettings sont les réglages appliqués aux agences sans configuration.
+ */
+var DefaultAgencySettings = AgencySettings{
+	Parallelism: 2,                          // Limite à 2 requêtes simultanées pour ne pas surcharger le serveur
+	Delay:       Duration{2 * time.Second},  // Attente de 2 secondes entre chaque requête pour éviter un blocage par le serveur
+	Timeout:     Duration{10 * time.Second}, // Délai par défaut de Colly
+
+	DetailRefresh: Duration{DefaultDetailRefresh}, // Les annonces connues sont revisitées quelques fois par jour
+	httpCacheDir:  DefaultHTTPCacheDir,
+	sessionDir:    DefaultSessionDir,
+}
+
+/**
+ * AgencySettings retourne les réglages HTTP d'une agence : les réglages par défaut complétés par la configuration.
+ * @param {Agency} agency - L'agence.
+ * @return {AgencySettings} - Les réglages.
+ */
+func (config *Config) AgencySettings(agency Agency) AgencySettings {
+	settings := DefaultAgencySettings
+	settings.headerProfiles = config.HeaderProfiles
+	if config.HTTPCacheDir != "" {
+		settings.httpCacheDir = config.HTTPCacheDir
+	}
+	if config.SessionDir != "" {
+		settings.sessionDir = config.SessionDir
+	}
+
+	for name, configured := range config.Agencies {
+		if found, exists := findAgency(name); !exists || found != agency {
+			continue
+		}
+		if configured.Parallelism != 0 {
+			settings.Parallelism = configured.Parallelism
+		}
+		if configured.Delay.Duration != 0 {
+			settings.Delay = configured.Delay
+		}
+		if configured.RandomDelay.Duration != 0 {
+			settings.RandomDelay = configured.RandomDelay
+		}
+		if configured.Timeout.Duration != 0 {
+			settings.Timeout = configured.Timeout
+		}
+		if configured.MaxRequests != 0 {
+			settings.MaxRequests = configured.MaxRequests
+		}
+		if configured.DetailRefresh.Duration != 0 {
+			settings.DetailRefresh = configured.DetailRefresh
+		}
+		if configured.HTTPCache {
+			settings.HTTPCache = true
+		}
+		if configured.Session != nil {
+			settings.Session = configured.Session
+		}
+		if configured.InsecureSkipVerify {
+			settings.InsecureSkipVerify = true
+		}
+		if configured.CAFile != "" {
+			settings.CAFile = configured.CAFile
+		}
+		if configured.HeaderProfile != "" {
+			settings.HeaderProfile = configured.HeaderProfile
+		}
+		settings.Requests = settings.Requests.Merge(configured.Requests)
+	}
+
+	return settings
+}
+
+/**
+ * Validate vérifie que les réglages ne sont pas négatifs et que le fichier de certificats est lisible.
+ * @return {error} - La première erreur trouvée.
+ */
+func (settings AgencySettings) Validate() error {
+	switch {
+	case settings.Parallelism < 0:
+		return fmt.Errorf("parallelism négatif : %d", settings.Parallelism)
+	case settings.Delay.Duration < 0:
+		return fmt.Errorf("delay négatif : %s", settings.Delay)
+	case settings.RandomDelay.Duration < 0:
+		return fmt.Errorf("randomDelay négatif : %s", settings.RandomDelay)
+	case settings.Timeout.Duration < 0:
+		return fmt.Errorf("timeout négatif : %s", settings.Timeout)
+	case settings.MaxRequests < 0:
+		return fmt.Errorf("maxRequests négatif : %d", settings.MaxRequests)
+	case settings.DetailRefresh.Duration < 0:
+		return fmt.Errorf("detailRefresh négatif : %s", settings.DetailRefresh)
+	}
+	if err := settings.Requests.Validate(); err != nil {
+		return err
+	}
+	if settings.Session != nil {
+		if err := settings.Session.Validate(); err != nil {
+			return err
+		}
+	}
+	if settings.CAFile != "" {
+		if _, err := loadCertPool(settings.CAFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * applySettings applique les réglages HTTP de l'agence à un collecteur : limites, transport, proxies, en-têtes
+ * et chaîne de traitement des requêtes.
+ * Le nombre maximal de requêtes est partagé entre tous les collecteurs du cycle.
+ * @param {colly.Collector} collector - Le collecteur à configurer.
+ * @return {void}
+ */
+func (collyService *CollyService) applySettings(collector *colly.Collector) {
+	settings := collyService.settings
+
+	// Définition des limites de requêtes pour éviter les blocages
+	collector.Limit(&colly.LimitRule{
+		DomainGlob:  "*", // Applique cette règle à tous les domaines visités par le collecteur
+		Parallelism: settings.Parallelism,
+		Delay:       settings.Delay.Duration,
+		RandomDelay: settings.RandomDelay.Duration,
+	})
+	transport := collyService.newTransport()
+	if collector == collyService.collector && settings.HTTPCache {
+		// Le cache HTTP ne concerne que les pages de résultats : inutile si chaque URL est rendue unique
+		if resolveRequestOptions(collyService.agency, settings.Requests).CacheBust == CacheBustQuery {
+			log.Printf("Cache HTTP désactivé pour l'agence %s : incompatible avec cacheBust \"query\"", collyService.agency)
+		} else {
+			transport = NewHTTPCache(settings.httpCacheDir, transport)
+		}
+	}
+	collector.WithTransport(transport)
+	if collyService.jar != nil {
+		collector.SetCookieJar(collyService.jar)
+	}
+	collector.SetRequestTimeout(settings.Timeout.Duration)
+	collyService.applyHeaderProfile(collector)
+	collyService.applyRequestMiddlewares(collector)
+
+	if collyService.proxies != nil {
+		collyService.trackProxyHealth(collector)
+	}
+	collyService.trackOutcomes(collector)
+
+	if settings.MaxRequests > 0 {
+		collector.OnRequest(func(r *colly.Request) {
+			count := atomic.AddInt64(&collyService.requests, 1)
+			if count > int64(settings.MaxRequests) {
+				r.Abort()
+				collyService.markIncomplete()
+				if count == int64(settings.MaxRequests)+1 {
+					log.Printf("Nombre maximal de requêtes par cycle atteint (%d), les pages suivantes sont ignorées", settings.MaxRequests)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Agences dont les pages de liste embarquent l'état JSON rendu côté serveur (Angular, SPA)
+var embeddedStateAgencies = map[Agency]bool{
+	Foncia:        true,
+	SquareHabitat: true,
+}
+
+// Expression régulière pour trouver les états JavaScript globaux (window.__INITIAL_STATE__ = {...})
+var windowStatePattern = regexp.MustCompile(`window\.__(?:INITIAL_STATE|PRELOADED_STATE|NUXT|APP_STATE)__\s*=\s*`)
+
+// Expression régulière pour trouver un nombre dans une valeur textuelle ("650 €", "45,5 m²")
+var stateNumberPattern = regexp.MustCompile(`\d[\d\s\x{00a0}\x{202f}.,]*`)
+
+// Échappements de l'état de transfert Angular (TransferState avant Angular 16)
+var angularStateReplacer = strings.NewReplacer("&q;", `"`, "&s;", "'", "&l;", "<", "&g;", ">", "&a;", "&")
+
+// Clés possibles des champs d'une annonce dans les états JSON, par ordre de préférence
+var (
+	stateReferenceKeys = []string{"reference", "ref", "referenceMandat", "numeroMandat", "mandat", "propertyReference", "sku", "productID", "identifier"}
+	stateURLKeys       = []string{"url", "urlDetail", "detailUrl", "link", "permalink", "href", "canonicalUrl"}
+	stateTitleKeys     = []string{"title", "titre", "name", "libelle", "intitule"}
+	statePriceKeys     = []string{"price", "prix", "loyer", "loyerCharges", "loyerCC", "prixLoyer", "rent", "montant"}
+	stateFeesKeys      = []string{"honoraires", "fees", "agencyFees", "honorairesAcquereur"}
+	stateChargesKeys   = []string{"chargesCopropriete", "chargesAnnuelles", "coOwnershipCharges", "annualCharges"}
+	stateLotsKeys      = []string{"nbLots", "nombreLots", "lots", "lotsCopropriete"}
+	stateEnergyKeys    = []string{"dpe", "classeEnergie", "energyClass", "consoEnergie"}
+	stateSurfaceKeys   = []string{"surface", "surfaceHabitable", "livingArea", "floorSize", "area"}
+	stateRoomsKeys     = []string{"rooms", "nbPieces", "nombrePieces", "pieces", "numberOfRooms", "nbRooms"}
+	stateCityKeys      = []string{"city", "ville", "addressLocality", "commune", "localite"}
+	statePostalKeys    = []string{"postalCode", "codePostal", "zipCode", "cp"}
+	statePhotoKeys     = []string{"photo", "image", "images", "photos", "picture", "thumbnail", "visuel"}
+	stateNestedKeys    = []string{"address", "adresse", "localisation", "location", "offers", "geo", "bien"}
+)
+
+// Types JSON-LD (schema.org) qui décrivent une annonce immobilière
+var jsonLDListingTypes = map[string]bool{
+	"RealEstateListing":     true,
+	"Offer":                 true,
+	"Product":               true,
+	"Apartment":             true,
+	"House":                 true,
+	"SingleFamilyResidence": true,
+	"Residence":             true,
+	"Accommodation":         true,
+}
+
+/**
+ * setupEmbeddedStateExtraction configure le collecteur pour extraire les annonces de l'état JSON embarqué dans la page
+ * (ng-state Angular, __NEXT_DATA__, JSON-LD, window.__INITIAL_STATE__).
+ * Ce mode ne dépend pas des classes CSS générées par les frameworks, qui changent à chaque nouvelle version du site.
+ * @param {colly.Collector} collector - Le collecteur à configurer.
+ * @param {[]Announcement} announcements - La liste des annonces à remplir.
+ * @return {void}
+ */
+func setupEmbeddedStateExtraction(collector *colly.Collector, announcements *[]Announcement) {
+	// Utiliser un ensemble pour éviter les doublons entre les différents états de la page
+	seenReferences := make(map[string]struct{})
+
+	collector.OnHTML("html", func(page *colly.HTMLElement) {
+		for _, state := range extractEmbeddedStates(page) {
+			for _, announcement := range findStateAnnouncements(state, page.Request.AbsoluteURL) {
+				if _, exists := seenReferences[announcement.propertyReference]; exists {
+					continue
+				}
+				seenReferences[announcement.propertyReference] = struct{}{}
+				*announcements = append(*announcements, announcement)
+			}
+		}
+	})
+}
+
+/**
+ * extractEmbeddedStates décode les états JSON embarqués dans la page.
+ * @param {colly.HTMLElement} page - L'élément <html> de la page.
+ * @return {[]any} - Les états décodés.
+ */
+func extractEmbeddedStates(page *colly.HTMLElement) []any {
+	var states []any
+
+	page.ForEach("script", func(_ int, script *colly.HTMLElement) {
+		id := script.Attr("id")
+		scriptType := script.Attr("type")
+		content := strings.TrimSpace(script.Text)
+		if content == "" {
+			return
+		}
+
+		var raw string
+		switch {
+		case id == "ng-state" || strings.HasSuffix(id, "-state"):
+			// État de transfert Angular, échappé avant Angular 16
+			raw = angularStateReplacer.Replace(content)
+		case id == "__NEXT_DATA__" || id == "__NUXT_DATA__":
+			raw = content
+		case scriptType == "application/ld+json":
+			raw = content
+		case scriptType == "" || scriptType == "text/javascript":
+			location := windowStatePattern.FindStringIndex(content)
+			if location == nil {
+				return
+			}
+			raw = content[location[1]:]
+		default:
+			return
+		}
+
+		// Un décodeur s'arrête à la fin de la première valeur JSON, ce qui ignore le code qui suit l'affectation
+		var state any
+		if err := json.NewDecoder(strings.NewReader(raw)).Decode(&state); err != nil {
+			log.Printf("État JSON illisible dans la page %s : %v", page.Request.URL, err)
+			return
+		}
+		states = append(states, state)
+	})
+
+	return states
+}
+
+/**
+ * findStateAnnouncements parcourt un état JSON et retourne les objets qui ressemblent à des annonces.
+ * Un objet est une annonce s'il a une référence et un prix ou une surface,
+ * ou si c'est un objet JSON-LD d'un type immobilier avec une URL.
+ * @param {any} state - L'état JSON décodé.
+ * @param {func(string) string} absoluteURL - Fonction pour rendre absolues les URLs relatives.
+ * @return {[]Announcement} - Les annonces trouvées.
+ */
+func findStateAnnouncements(state any, absoluteURL func(string) string) []Announcement {
+	var announcements []Announcement
+
+	var walk func(value any)
+	walk = func(value any) {
+		switch node := value.(type) {
+		case []any:
+			for _, item := range node {
+				walk(item)
+			}
+		case map[string]any:
+			if announcement, ok := newStateAnnouncement(node, absoluteURL); ok {
+				// Ne pas descendre dans une annonce : ses sous-objets (agence, photos) ne sont pas des annonces
+				announcements = append(announcements, announcement)
+				return
+			}
+			for _, child := range node {
+				walk(child)
+			}
+		case string:
+			// Certains états contiennent des réponses d'API encodées en chaîne JSON
+			if trimmed := strings.TrimSpace(node); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+				var nested any
+				if err := json.Unmarshal([]byte(trimmed), &nested); err == nil {
+					walk(nested)
+				}
+			}
+		}
+	}
+	walk(state)
+
+	return announcements
+}
+
+/**
+ * newStateAnnouncement convertit un objet d'un état JSON en annonce.
+ * @param {map[string]any} node - L'objet JSON.
+ * @param {func(string) string} absoluteURL - Fonction pour rendre absolues les URLs relatives.
+ * @return {Announcement} - L'annonce.
+ * @return {bool} - Faux si l'objet ne ressemble pas à une annonce.
+ */
+func newStateAnnouncement(node map[string]any, absoluteURL func(string) string) (Announcement, bool) {
+	reference := stateString(node, stateReferenceKeys)
+	url := stateString(node, stateURLKeys)
+	jsonLD := isJSONLDListing(node)
+
+	announcement := Announcement{
+		propertyReference:  reference,
+		title:              stateString(node, stateTitleKeys),
+		price:              stateNumber(node, statePriceKeys),
+		surface:            stateNumber(node, stateSurfaceKeys),
+		rooms:              int(stateNumber(node, stateRoomsKeys)),
+		city:               stateCity(node),
+		photo:              stateString(node, statePhotoKeys),
+		agencyFees:         stateNumber(node, stateFeesKeys),
+		coOwnershipCharges: stateNumber(node, stateChargesKeys),
+		lots:               int(stateNumber(node, stateLotsKeys)),
+		energyClass:        firstEnergyClass("DPE " + strings.ToUpper(stateString(node, stateEnergyKeys))),
+	}
+	if url != "" {
+		announcement.url = absoluteURL(url)
+	}
+	if announcement.photo != "" {
+		announcement.photo = absoluteURL(announcement.photo)
+	}
+	announcement.latitude, announcement.longitude, _ = stateCoordinates(node)
+
+	// Les objets JSON-LD n'ont pas toujours de référence : l'identifiant de l'URL de l'annonce en tient lieu
+	if jsonLD && reference == "" {
+		announcement.propertyReference = referenceFromURL(announcement.url)
+	}
+
+	if announcement.propertyReference == "" {
+		return Announcement{}, false
+	}
+	if !jsonLD && announcement.price == 0 && announcement.surface == 0 {
+		return Announcement{}, false
+	}
+	if jsonLD && announcement.url == "" {
+		return Announcement{}, false
+	}
+	return announcement, true
+}
+
+/**
+ * isJSONLDListing indique si un objet est un objet JSON-LD d'un type immobilier.
+ * @param {map[string]any} node - L'objet JSON.
+ * @return {bool} - Vrai si l'objet décrit une annonce.
+ */
+func isJSONLDListing(node map[string]any) bool {
+	switch types := node["@type"].(type) {
+	case string:
+		return jsonLDListingTypes[types]
+	case []any:
+		for _, value := range types {
+			if name, ok := value.(string); ok && jsonLDListingTypes[name] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/**
+ * stateValue retourne la première valeur présente parmi les clés, en cherchant aussi dans les sous-objets usuels
+ * (adresse, localisation, offre).
+ * @param {map[string]any} node - L'objet JSON.
+ * @param {[]string} keys - Les clés possibles, par ordre de préférence.
+ * @return {any} - La valeur, nil si absente.
+ */
+func stateValue(node map[string]any, keys []string) any {
+	for _, key := range keys {
+		if value, exists := node[key]; exists && value != nil && value != "" {
+			return value
+		}
+	}
+	for _, nestedKey := range stateNestedKeys {
+		if nested, ok := node[nestedKey].(map[string]any); ok {
+			for _, key := range keys {
+				if value, exists := nested[key]; exists && value != nil && value != "" {
+					return value
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/**
+ * stateString retourne une valeur textuelle d'un objet JSON.
+ * Les nombres sont convertis en texte, les listes donnent leur premier élément et les objets leur champ url ou value.
+ * @param {map[string]any} node - L'objet JSON.
+ * @param {[]string} keys - Les clés possibles, par ordre de préférence.
+ * @return {string} - La valeur, vide si absente.
+ */
+func stateString(node map[string]any, keys []string) string {
+	return stateText(stateValue(node, keys))
+}
+
+/**
+ * stateText convertit une valeur JSON en texte.
+ * @param {any} value - La valeur JSON.
+ * @return {string} - Le texte, vide si la valeur n'est pas convertible.
+ */
+func stateText(value any) string {
+	switch typed := value.(type) {
+	case string:
+		return strings.TrimSpace(typed)
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case []any:
+		if len(typed) > 0 {
+			return stateText(typed[0])
+		}
+	case map[string]any:
+		for _, key := range []string{"url", "src", "value", "@id", "name"} {
+			if text := stateText(typed[key]); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+/**
+ * stateNumber retourne une valeur numérique d'un objet JSON, écrite en nombre ou en texte ("650 €").
+ * @param {map[string]any} node - L'objet JSON.
+ * @param {[]string} keys - Les clés possibles, par ordre de préférence.
+ * @return {float64} - La valeur, 0 si absente.
+ */
+func stateNumber(node map[string]any, keys []string) float64 {
+	switch typed := stateValue(node, keys).(type) {
+	case float64:
+		return typed
+	case string:
+		return parseFrenchNumber(strings.TrimRight(stateNumberPattern.FindString(typed), " .,"))
+	case map[string]any:
+		// Valeur quantitative JSON-LD : {"@type": "QuantitativeValue", "value": 45}
+		return stateNumber(typed, []string{"value", "amount", "price"})
+	}
+	return 0
+}
+
+/**
+ * stateCity retourne la ville d'un objet JSON, suivie de son code postal s'il est connu.
+ * @param {map[string]any} node - L'objet JSON.
+ * @return {string} - La ville au même format que firstCity, vide si absente.
+ */
+func stateCity(node map[string]any) string {
+	city := stateString(node, stateCityKeys)
+	if city == "" {
+		return ""
+	}
+	if postalCode := stateString(node, statePostalKeys); postalCode != "" {
+		return fmt.Sprintf("%s (%s)", city, postalCode)
+	}
+	return city
+}
+
+/**
+ * stateCoordinates retourne les coordonnées d'un objet JSON (champs latitude/longitude ou objet geo).
+ * @param {map[string]any} node - L'objet JSON.
+ * @return {float64} - La latitude.
+ * @return {float64} - La longitude.
+ * @return {bool} - Faux si aucune coordonnée valide n'a été trouvée.
+ */
+func stateCoordinates(node map[string]any) (float64, float64, bool) {
+	return parseCoordinates(
+		stateString(node, []string{"latitude", "lat"}),
+		stateString(node, []string{"longitude", "lng", "lon"}),
+	)
+}
@@ -0,0 +1,654 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * AnnouncementStatus est le statut d'une annonce stockée.
+ */
+type AnnouncementStatus string
+
+/**
+ * Constantes pour les statuts des annonces.
+ */
+const (
+	StatusActive  AnnouncementStatus = "active"  // L'annonce est présente dans les derniers résultats de l'agence
+	StatusRemoved AnnouncementStatus = "removed" // L'annonce a disparu des résultats de l'agence
+)
+
+/**
+ * Constantes pour les types d'événements de l'historique d'une annonce.
+ */
+const (
+	EventFirstSeen     = "first_seen"
+	EventPriceChanged  = "price_changed"
+	EventStatusChanged = "status_changed"
+)
+
+/**
+ * AnnouncementEvent est un événement de l'historique d'une annonce (apparition, changement de prix ou de statut).
+ * @property {time.Time} Time - Date de l'événement.
+ * @property {string} Type - Type de l'événement.
+ * @property {float64} Price - Prix au moment de l'événement.
+ * @property {AnnouncementStatus} Status - Statut au moment de l'événement.
+ */
+type AnnouncementEvent struct {
+	Time   time.Time          `json:"time"`
+	Type   string             `json:"type"`
+	Price  float64            `json:"price,omitempty"`
+	Status AnnouncementStatus `json:"status,omitempty"`
+}
+
+/**
+ * StoredAnnouncement est une annonce conservée dans le store avec son cycle de vie.
+ * Les honoraires, les charges et les lots de la copropriété ne concernent que les ventes.
+ */
+type StoredAnnouncement struct {
+	Agency      Agency          `json:"agency"`
+	Transaction TransactionType `json:"transaction"`
+	Reference   string          `json:"reference"`
+	URL         string          `json:"url"`
+	Title       string          `json:"title,omitempty"`
+	Price       float64         `json:"price,omitempty"`
+	Surface     float64         `json:"surface,omitempty"`
+	Rooms       int             `json:"rooms,omitempty"`
+	City        string          `json:"city,omitempty"`
+	Photo       string          `json:"photo,omitempty"`
+	Latitude    float64         `json:"latitude,omitempty"`
+	Longitude   float64         `json:"longitude,omitempty"`
+
+	AgencyFees         float64 `json:"agency_fees,omitempty"`
+	CoOwnershipCharges float64 `json:"co_ownership_charges,omitempty"`
+	Lots               int     `json:"lots,omitempty"`
+	EnergyClass        string  `json:"energy_class,omitempty"`
+
+	Status    AnnouncementStatus  `json:"status"`
+	FirstSeen time.Time           `json:"first_seen"`
+	LastSeen  time.Time           `json:"last_seen"`
+	RemovedAt *time.Time          `json:"removed_at,omitempty"`
+	Notified  bool                `json:"notified"`
+	History   []AnnouncementEvent `json:"history,omitempty"`
+}
+
+/**
+ * AgencyHealth contient l'état de santé du scraping d'une agence.
+ */
+type AgencyHealth struct {
+	Agency              Agency    `json:"agency"`
+	LastRun             time.Time `json:"last_run"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastErrorAt         time.Time `json:"last_error_at,omitempty"`
+	LastCount           int       `json:"last_count"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	TotalRuns           int       `json:"total_runs"`
+	TotalErrors         int       `json:"total_errors"`
+	ActiveAnnouncements int       `json:"active_announcements"`
+}
+
+/**
+ * storeFile est le format du fichier JSON du store.
+ */
+type storeFile struct {
+	ReferenceVersion int                      `json:"reference_version"`
+	Announcements    []*StoredAnnouncement    `json:"announcements"`
+	Health           map[Agency]*AgencyHealth `json:"health"`
+	DetailURLs       map[string]*DetailURL    `json:"detail_urls,omitempty"`
+}
+
+/**
+ * Store conserve les annonces et la santé des agences, persistés dans un fichier JSON.
+ * @property {sync.RWMutex} mu - Verrou protégeant l'accès concurrent (scraper et API).
+ * @property {string} path - Chemin du fichier JSON (pas de persistance si vide).
+ * @property {map[string]*StoredAnnouncement} announcements - Annonces indexées par clé agence + transaction + référence.
+ * @property {map[Agency]*AgencyHealth} health - Santé des agences.
+ * @property {map[string]*DetailURL} detailURLs - Références des pages de détails déjà visitées, indexées par URL.
+ */
+type Store struct {
+	mu            sync.RWMutex
+	path          string
+	announcements map[string]*StoredAnnouncement
+	health        map[Agency]*AgencyHealth
+	detailURLs    map[string]*DetailURL
+}
+
+/**
+ * OpenStore ouvre le store et charge le fichier JSON s'il existe.
+ * @param {string} path - Chemin du fichier JSON (pas de persistance si vide).
+ * @return {*Store} - Le store.
+ * @return {error} - Erreur si le fichier existe mais est illisible.
+ */
+func OpenStore(path string) (*Store, error) {
+	store := newStore(path)
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lecture du store %s : %w", path, err)
+	}
+
+	migrated, err := store.load(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %w", path, err)
+	}
+	if migrated {
+		store.saveLocked()
+	}
+	return store, nil
+}
+
+/**
+ * ReadStore charge le fichier JSON du store en lecture seule, pour les commandes qui ne font que le lire (export).
+ * Le fichier n'est jamais réécrit : une migration des références n'est appliquée qu'en mémoire.
+ * @param {string} path - Chemin du fichier JSON.
+ * @return {*Store} - Le store, sans persistance.
+ * @return {error} - Erreur si le fichier est absent, illisible ou invalide.
+ */
+func ReadStore(path string) (*Store, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("lecture du store %s : %w", path, err)
+	}
+
+	store := newStore("")
+	if _, err := store.load(data); err != nil {
+		return nil, fmt.Errorf("%s : %w", path, err)
+	}
+	return store, nil
+}
+
+/**
+ * newStore crée un store vide.
+ * @param {string} path - Chemin du fichier JSON (pas de persistance si vide).
+ * @return {*Store} - Le store.
+ */
+func newStore(path string) *Store {
+	return &Store{
+		path:          path,
+		announcements: make(map[string]*StoredAnnouncement),
+		health:        make(map[Agency]*AgencyHealth),
+		detailURLs:    make(map[string]*DetailURL),
+	}
+}
+
+/**
+ * load remplit le store à partir du contenu de son fichier JSON, et recalcule les clés si les règles
+ * de normalisation des références ont changé depuis l'écriture du fichier.
+ * @param {[]byte} data - Le contenu du fichier.
+ * @return {bool} - Vrai si les références ont été migrées : le fichier est à réécrire.
+ * @return {error} - Erreur si le contenu est invalide.
+ */
+func (store *Store) load(data []byte) (bool, error) {
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return false, fmt.Errorf("décodage du store : %w", err)
+	}
+	// Les stores écrits avant les annonces de vente ne contiennent que des locations
+	for _, announcement := range file.Announcements {
+		if announcement.Transaction == "" {
+			announcement.Transaction = TransactionRent
+		}
+		store.announcements[announcement.key()] = announcement
+	}
+	for agency, health := range file.Health {
+		store.health[agency] = health
+	}
+	for url, entry := range file.DetailURLs {
+		if entry.Transaction == "" {
+			entry.Transaction = TransactionRent
+		}
+		store.detailURLs[url] = entry
+	}
+
+	// Recalculer les clés si les règles de normalisation des références ont changé depuis l'écriture du store
+	if file.ReferenceVersion < ReferenceRulesVersion {
+		changed := store.migrateReferencesLocked()
+		log.Printf("Migration des références du store (version %d vers %d) : %d annonce(s) modifiée(s)", file.ReferenceVersion, ReferenceRulesVersion, changed)
+		return true, nil
+	}
+	return false, nil
+}
+
+/**
+ * announcementKey retourne la clé d'une annonce dans le store. Une agence peut utiliser la même référence
+ * pour la location et la vente d'un bien : ce sont deux annonces distinctes.
+ * @param {Agency} agency - L'agence.
+ * @param {TransactionType} transaction - Le type de transaction.
+ * @param {string} reference - La référence du bien.
+ * @return {string} - La clé.
+ */
+func announcementKey(agency Agency, transaction TransactionType, reference string) string {
+	return string(agency) + "|" + string(transaction) + "|" + reference
+}
+
+/**
+ * key retourne la clé de l'annonce dans le store.
+ * @return {string} - La clé.
+ */
+func (stored *StoredAnnouncement) key() string {
+	return announcementKey(stored.Agency, stored.Transaction, stored.Reference)
+}
+
+/**
+ * Sync met à jour le store avec les annonces d'un cycle de scraping d'une agence, pour un type de transaction.
+ * Les annonces absentes des résultats passent au statut "removed", sauf si le scraping n'a rien retourné
+ * ou si le cycle est incomplet (pages non lues) : une annonce absente n'a alors peut-être simplement pas été lue.
+ * @param {Agency} agency - L'agence scrapée.
+ * @param {TransactionType} transaction - Le type de transaction de la recherche.
+ * @param {[]Announcement} announcements - Les annonces trouvées pendant le cycle.
+ * @param {bool} complete - Vrai si toutes les pages du cycle ont été lues.
+ * @param {time.Time} now - La date du cycle.
+ * @return {[]StoredAnnouncement} - Les annonces qui n'ont pas encore été notifiées.
+ */
+func (store *Store) Sync(agency Agency, transaction TransactionType, announcements []Announcement, complete bool, now time.Time) []StoredAnnouncement {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var pending []StoredAnnouncement
+	seen := make(map[string]bool)
+
+	for _, announcement := range announcements {
+		key := announcementKey(agency, transaction, announcement.propertyReference)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		stored, exists := store.announcements[key]
+		if !exists {
+			stored = &StoredAnnouncement{
+				Agency:      agency,
+				Transaction: transaction,
+				Reference:   announcement.propertyReference,
+				Status:      StatusActive,
+				FirstSeen:   now,
+				History:     []AnnouncementEvent{{Time: now, Type: EventFirstSeen, Price: announcement.price, Status: StatusActive}},
+			}
+			store.announcements[key] = stored
+		} else if stored.Status != StatusActive {
+			stored.Status = StatusActive
+			stored.RemovedAt = nil
+			stored.History = append(stored.History, AnnouncementEvent{Time: now, Type: EventStatusChanged, Price: announcement.price, Status: StatusActive})
+		}
+
+		if exists && announcement.price != 0 && stored.Price != 0 && announcement.price != stored.Price {
+			stored.History = append(stored.History, AnnouncementEvent{Time: now, Type: EventPriceChanged, Price: announcement.price, Status: stored.Status})
+		}
+		stored.update(announcement)
+		stored.LastSeen = now
+
+		if !stored.Notified {
+			pending = append(pending, stored.clone())
+		}
+	}
+
+	// Un scraping vide est plus probablement un blocage qu'une disparition de toutes les annonces
+	if complete && len(seen) > 0 {
+		for key, stored := range store.announcements {
+			if stored.Agency == agency && stored.Transaction == transaction && stored.Status == StatusActive && !seen[key] {
+				removedAt := now
+				stored.Status = StatusRemoved
+				stored.RemovedAt = &removedAt
+				stored.History = append(stored.History, AnnouncementEvent{Time: now, Type: EventStatusChanged, Price: stored.Price, Status: StatusRemoved})
+			}
+		}
+	}
+
+	store.saveLocked()
+	return pending
+}
+
+/**
+ * update recopie les caractéristiques connues de l'annonce scrapée, sans effacer celles déjà stockées.
+ * @param {Announcement} announcement - L'annonce scrapée.
+ * @return {void}
+ */
+func (stored *StoredAnnouncement) update(announcement Announcement) {
+	if announcement.url != "" {
+		stored.URL = announcement.url
+	}
+	if announcement.title != "" {
+		stored.Title = announcement.title
+	}
+	if announcement.price != 0 {
+		stored.Price = announcement.price
+	}
+	if announcement.surface != 0 {
+		stored.Surface = announcement.surface
+	}
+	if announcement.rooms != 0 {
+		stored.Rooms = announcement.rooms
+	}
+	if announcement.city != "" {
+		stored.City = announcement.city
+	}
+	if announcement.photo != "" {
+		stored.Photo = announcement.photo
+	}
+	if announcement.latitude != 0 || announcement.longitude != 0 {
+		stored.Latitude = announcement.latitude
+		stored.Longitude = announcement.longitude
+	}
+	if announcement.agencyFees != 0 {
+		stored.AgencyFees = announcement.agencyFees
+	}
+	if announcement.coOwnershipCharges != 0 {
+		stored.CoOwnershipCharges = announcement.coOwnershipCharges
+	}
+	if announcement.lots != 0 {
+		stored.Lots = announcement.lots
+	}
+	if announcement.energyClass != "" {
+		stored.EnergyClass = announcement.energyClass
+	}
+}
+
+/**
+ * MarkNotified marque une annonce comme notifiée, pour ne plus l'envoyer aux cycles suivants.
+ * @param {Agency} agency - L'agence.
+ * @param {TransactionType} transaction - Le type de transaction.
+ * @param {string} reference - La référence du bien.
+ * @return {void}
+ */
+func (store *Store) MarkNotified(agency Agency, transaction TransactionType, reference string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if stored, exists := store.announcements[announcementKey(agency, transaction, reference)]; exists {
+		stored.Notified = true
+		store.saveLocked()
+	}
+}
+
+/**
+ * RecordRun enregistre le résultat d'un cycle de scraping dans la santé de l'agence.
+ * @param {Agency} agency - L'agence scrapée.
+ * @param {int} count - Nombre d'annonces trouvées.
+ * @param {[]error} errs - Erreurs rencontrées pendant le cycle.
+ * @param {time.Time} now - La date du cycle.
+ * @return {void}
+ */
+func (store *Store) RecordRun(agency Agency, count int, errs []error, now time.Time) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	health, exists := store.health[agency]
+	if !exists {
+		health = &AgencyHealth{Agency: agency}
+		store.health[agency] = health
+	}
+
+	health.LastRun = now
+	health.LastCount = count
+	health.TotalRuns++
+	if len(errs) > 0 {
+		health.LastError = errs[len(errs)-1].Error()
+		health.LastErrorAt = now
+		health.TotalErrors += len(errs)
+	}
+
+	// Un cycle est réussi s'il a trouvé des annonces, même si quelques pages de détails ont échoué
+	if count > 0 || len(errs) == 0 {
+		health.LastSuccess = now
+		health.ConsecutiveFailures = 0
+	} else {
+		health.ConsecutiveFailures++
+	}
+
+	store.saveLocked()
+}
+
+/**
+ * Get retourne une annonce du store avec son historique complet.
+ * @param {Agency} agency - L'agence.
+ * @param {TransactionType} transaction - Le type de transaction, vide pour chercher la location puis la vente.
+ * @param {string} reference - La référence du bien.
+ * @return {StoredAnnouncement} - L'annonce.
+ * @return {bool} - Faux si l'annonce n'existe pas.
+ */
+func (store *Store) Get(agency Agency, transaction TransactionType, reference string) (StoredAnnouncement, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	transactions := []TransactionType{transaction}
+	if transaction == "" {
+		transactions = []TransactionType{TransactionRent, TransactionSale}
+	}
+	for _, transaction := range transactions {
+		stored, exists := store.announcements[announcementKey(agency, transaction, reference)]
+		if !exists {
+			// La référence peut être donnée telle qu'affichée par l'agence ("Réf : ab123")
+			stored, exists = store.announcements[announcementKey(agency, transaction, normalizeReference(agency, reference))]
+		}
+		if exists {
+			return stored.clone(), true
+		}
+	}
+	return StoredAnnouncement{}, false
+}
+
+/**
+ * Query retourne les annonces correspondant au filtre, triées.
+ * @param {AnnouncementFilter} filter - Le filtre à appliquer.
+ * @param {string} sortBy - Le champ de tri, préfixé par "-" pour un tri décroissant.
+ * @return {[]StoredAnnouncement} - Les annonces trouvées.
+ */
+func (store *Store) Query(filter AnnouncementFilter, sortBy string) []StoredAnnouncement {
+	store.mu.RLock()
+	var results []StoredAnnouncement
+	for _, stored := range store.announcements {
+		if filter.Matches(stored) {
+			results = append(results, stored.clone())
+		}
+	}
+	store.mu.RUnlock()
+
+	sortAnnouncements(results, sortBy)
+	return results
+}
+
+/**
+ * Health retourne la santé de toutes les agences, triée par nom d'agence.
+ * @return {[]AgencyHealth} - La santé des agences.
+ */
+func (store *Store) Health() []AgencyHealth {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	active := make(map[Agency]int)
+	for _, stored := range store.announcements {
+		if stored.Status == StatusActive {
+			active[stored.Agency]++
+		}
+	}
+
+	var results []AgencyHealth
+	for agency, health := range store.health {
+		result := *health
+		result.ActiveAnnouncements = active[agency]
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Agency < results[j].Agency })
+
+	return results
+}
+
+/**
+ * clone retourne une copie de l'annonce, historique compris, pour la lire hors du verrou.
+ * @return {StoredAnnouncement} - La copie.
+ */
+func (stored *StoredAnnouncement) clone() StoredAnnouncement {
+	copied := *stored
+	copied.History = append([]AnnouncementEvent(nil), stored.History...)
+	if stored.RemovedAt != nil {
+		removedAt := *stored.RemovedAt
+		copied.RemovedAt = &removedAt
+	}
+	return copied
+}
+
+/**
+ * saveLocked écrit le store dans son fichier JSON. Le verrou doit être détenu.
+ * L'écriture passe par un fichier temporaire pour ne jamais laisser un store tronqué.
+ * @return {void}
+ */
+func (store *Store) saveLocked() {
+	if store.path == "" {
+		return
+	}
+
+	file := storeFile{ReferenceVersion: ReferenceRulesVersion, Health: store.health, DetailURLs: store.detailURLs}
+	for _, stored := range store.announcements {
+		file.Announcements = append(file.Announcements, stored)
+	}
+	sort.Slice(file.Announcements, func(i, j int) bool {
+		return file.Announcements[i].key() < file.Announcements[j].key()
+	})
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		log.Printf("Erreur lors de l'écriture du store : %v", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(store.path), 0o755); err != nil {
+		log.Printf("Erreur lors de l'écriture du store : %v", err)
+		return
+	}
+	tmpPath := store.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		log.Printf("Erreur lors de l'écriture du store : %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, store.path); err != nil {
+		log.Printf("Erreur lors de l'écriture du store : %v", err)
+	}
+}
+
+/**
+ * AnnouncementFilter est un filtre sur les annonces du store. Les champs à zéro ne filtrent pas.
+ */
+type AnnouncementFilter struct {
+	Agencies      []Agency
+	Transaction   TransactionType
+	Status        AnnouncementStatus
+	MinPrice      float64
+	MaxPrice      float64
+	MinSurface    float64
+	MaxSurface    float64
+	City          string
+	FirstSeenFrom time.Time
+	FirstSeenTo   time.Time
+}
+
+/**
+ * Matches indique si une annonce correspond au filtre.
+ * @param {*StoredAnnouncement} stored - L'annonce à tester.
+ * @return {bool} - Vrai si l'annonce correspond.
+ */
+func (filter AnnouncementFilter) Matches(stored *StoredAnnouncement) bool {
+	if len(filter.Agencies) > 0 {
+		found := false
+		for _, agency := range filter.Agencies {
+			if strings.EqualFold(string(agency), string(stored.Agency)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if filter.Transaction != "" && filter.Transaction != stored.Transaction {
+		return false
+	}
+	if filter.Status != "" && filter.Status != stored.Status {
+		return false
+	}
+	// Une annonce sans prix ou sans surface connus ne passe pas un filtre sur ces champs
+	if filter.MinPrice > 0 && (stored.Price == 0 || stored.Price < filter.MinPrice) {
+		return false
+	}
+	if filter.MaxPrice > 0 && (stored.Price == 0 || stored.Price > filter.MaxPrice) {
+		return false
+	}
+	if filter.MinSurface > 0 && (stored.Surface == 0 || stored.Surface < filter.MinSurface) {
+		return false
+	}
+	if filter.MaxSurface > 0 && (stored.Surface == 0 || stored.Surface > filter.MaxSurface) {
+		return false
+	}
+	if filter.City != "" && !strings.Contains(strings.ToLower(stored.City), strings.ToLower(filter.City)) {
+		return false
+	}
+	if !filter.FirstSeenFrom.IsZero() && stored.FirstSeen.Before(filter.FirstSeenFrom) {
+		return false
+	}
+	if !filter.FirstSeenTo.IsZero() && !stored.FirstSeen.Before(filter.FirstSeenTo) {
+		return false
+	}
+	return true
+}
+
+/**
+ * sortAnnouncements trie les annonces selon un champ, préfixé par "-" pour un tri décroissant.
+ * Par défaut, les annonces les plus récentes sont en premier.
+ * @param {[]StoredAnnouncement} announcements - Les annonces à trier.
+ * @param {string} sortBy - Le champ de tri (first_seen, last_seen, price, surface).
+ * @return {void}
+ */
+func sortAnnouncements(announcements []StoredAnnouncement, sortBy string) {
+	if sortBy == "" {
+		sortBy = "-first_seen"
+	}
+	descending := strings.HasPrefix(sortBy, "-")
+	field := strings.TrimPrefix(sortBy, "-")
+
+	less := func(a, b *StoredAnnouncement) bool {
+		switch field {
+		case "price":
+			return a.Price < b.Price
+		case "surface":
+			return a.Surface < b.Surface
+		case "last_seen":
+			return a.LastSeen.Before(b.LastSeen)
+		default:
+			return a.FirstSeen.Before(b.FirstSeen)
+		}
+	}
+
+	sort.SliceStable(announcements, func(i, j int) bool {
+		if descending {
+			return less(&announcements[j], &announcements[i])
+		}
+		return less(&announcements[i], &announcements[j])
+	})
+}
+
+/**
+ * isValidSortField indique si le champ de tri est supporté.
+ * @param {string} sortBy - Le champ de tri, éventuellement préfixé par "-".
+ * @return {bool} - Vrai si le champ est supporté.
+ */
+func isValidSortField(sortBy string) bool {
+	switch strings.TrimPrefix(sortBy, "-") {
+	case "", "first_seen", "last_seen", "price", "surface":
+		return true
+	}
+	return false
+}
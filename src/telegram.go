@@ -15,15 +15,23 @@ const (
 
 // sendTelegramMessageToPublicChannel envoie un message à un canal Telegram public.
 func sendTelegramMessageToPublicChannel(message string) {
+	// Créer un nouveau message pour le canal
+	sendTelegramMessage(tgbotapi.NewMessageToChannel(TelegramChannel, message))
+}
+
+// sendTelegramMessageToAdminChat envoie une alerte au chat Telegram d'administration.
+func sendTelegramMessageToAdminChat(chatID int64, message string) {
+	sendTelegramMessage(tgbotapi.NewMessage(chatID, message))
+}
+
+// sendTelegramMessage envoie un message Telegram, en réessayant si l'API limite le débit.
+func sendTelegramMessage(msg tgbotapi.MessageConfig) {
 	// Initialiser le bot Telegram
 	bot, err := tgbotapi.NewBotAPI(TelegramBotToken)
 	if err != nil {
 		log.Fatalf("Erreur lors de la création du bot Telegram : %v", err)
 	}
 
-	// Créer un nouveau message pour le canal
-	msg := tgbotapi.NewMessageToChannel(TelegramChannel, message)
-
 	retries := 0
 
 	for {
@@ -39,7 +47,7 @@ func sendTelegramMessageToPublicChannel(message string) {
 				return
 			}
 		} else {
-			log.Println("Message envoyé au canal Telegram.")
+			log.Println("Message Telegram envoyé.")
 			return
 		}
 
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"time"
+)
+
+// Délai par défaut avant de revisiter la page de détails d'une annonce déjà connue
+const DefaultDetailRefresh = 6 * time.Hour
+
+/**
+ * DetailURL associe l'URL d'une page de détails à la référence de l'annonce qu'elle contient.
+ * @property {Agency} Agency - L'agence.
+ * @property {TransactionType} Transaction - Le type de transaction de la recherche qui a trouvé la page.
+ * @property {string} Reference - La référence canonique de l'annonce.
+ * @property {time.Time} FetchedAt - Date de la dernière visite de la page.
+ * @property {time.Time} LastSeen - Date du dernier cycle où l'URL figurait dans les résultats.
+ */
+type DetailURL struct {
+	Agency      Agency          `json:"agency"`
+	Transaction TransactionType `json:"transaction"`
+	Reference   string          `json:"reference"`
+	FetchedAt   time.Time       `json:"fetched_at"`
+	LastSeen    time.Time       `json:"last_seen"`
+}
+
+/**
+ * detailPage est le résultat d'une page de détails pendant un cycle : visitée, ou reprise du store.
+ * @property {string} url - L'URL de la page de détails.
+ * @property {string} reference - La référence canonique de l'annonce, vide si la page n'en contenait pas.
+ * @property {bool} fetched - Vrai si la page a été visitée pendant le cycle.
+ */
+type detailPage struct {
+	url       string
+	reference string
+	fetched   bool
+}
+
+/**
+ * KnownListings retourne les annonces actives d'une agence dont la page de détails a été visitée récemment,
+ * indexées par URL : ces pages ne sont pas revisitées avant le délai de rafraîchissement.
+ * @param {Agency} agency - L'agence.
+ * @param {TransactionType} transaction - Le type de transaction de la recherche.
+ * @param {time.Duration} refresh - Le délai avant de revisiter une page de détails.
+ * @param {time.Time} now - La date du cycle.
+ * @return {map[string]Announcement} - Les annonces connues, indexées par URL de la page de détails.
+ */
+func (store *Store) KnownListings(agency Agency, transaction TransactionType, refresh time.Duration, now time.Time) map[string]Announcement {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	known := make(map[string]Announcement)
+	for url, entry := range store.detailURLs {
+		if entry.Agency != agency || entry.Transaction != transaction || now.Sub(entry.FetchedAt) >= refresh {
+			continue
+		}
+		// Une annonce retirée qui réapparaît est revisitée : son contenu a pu changer
+		stored, exists := store.announcements[announcementKey(agency, transaction, entry.Reference)]
+		if !exists || stored.Status != StatusActive {
+			continue
+		}
+		known[url] = stored.announcement()
+	}
+	return known
+}
+
+/**
+ * ActiveListings retourne les annonces actives d'une agence, reprises quand sa page de résultats n'a pas changé.
+ * @param {Agency} agency - L'agence.
+ * @param {TransactionType} transaction - Le type de transaction de la recherche.
+ * @return {[]Announcement} - Les annonces actives.
+ */
+func (store *Store) ActiveListings(agency Agency, transaction TransactionType) []Announcement {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var listings []Announcement
+	for _, stored := range store.announcements {
+		if stored.Agency == agency && stored.Transaction == transaction && stored.Status == StatusActive {
+			listings = append(listings, stored.announcement())
+		}
+	}
+	return listings
+}
+
+/**
+ * RecordDetailPages enregistre les pages de détails d'un cycle : la référence et la date de visite
+ * des pages visitées, la date de passage de toutes. Les URLs de l'agence absentes des résultats sont oubliées.
+ * @param {Agency} agency - L'agence.
+ * @param {TransactionType} transaction - Le type de transaction de la recherche.
+ * @param {[]detailPage} pages - Les pages de détails du cycle.
+ * @param {time.Time} now - La date du cycle.
+ * @return {void}
+ */
+func (store *Store) RecordDetailPages(agency Agency, transaction TransactionType, pages []detailPage, now time.Time) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	seen := make(map[string]bool, len(pages))
+	for _, page := range pages {
+		seen[page.url] = true
+
+		entry, exists := store.detailURLs[page.url]
+		if page.fetched {
+			// Une page sans référence (erreur, annonce retirée) sera revisitée au prochain cycle
+			if page.reference == "" {
+				delete(store.detailURLs, page.url)
+				continue
+			}
+			entry = &DetailURL{Agency: agency, Transaction: transaction, Reference: page.reference, FetchedAt: now}
+			store.detailURLs[page.url] = entry
+		} else if !exists {
+			continue
+		}
+		entry.LastSeen = now
+	}
+
+	// Un cycle sans résultat est plus probablement un blocage : les URLs connues sont conservées
+	if len(pages) > 0 {
+		for url, entry := range store.detailURLs {
+			if entry.Agency == agency && entry.Transaction == transaction && !seen[url] {
+				delete(store.detailURLs, url)
+			}
+		}
+	}
+
+	store.saveLocked()
+}
+
+/**
+ * announcement reconstruit l'annonce scrapée à partir de l'annonce stockée.
+ * @return {Announcement} - L'annonce.
+ */
+func (stored *StoredAnnouncement) announcement() Announcement {
+	return Announcement{
+		propertyReference:  stored.Reference,
+		url:                stored.URL,
+		title:              stored.Title,
+		price:              stored.Price,
+		surface:            stored.Surface,
+		rooms:              stored.Rooms,
+		city:               stored.City,
+		photo:              stored.Photo,
+		latitude:           stored.Latitude,
+		longitude:          stored.Longitude,
+		agencyFees:         stored.AgencyFees,
+		coOwnershipCharges: stored.CoOwnershipCharges,
+		lots:               stored.Lots,
+		energyClass:        stored.EnergyClass,
+	}
+}
@@ -0,0 +1,53 @@
+// Affiche les annonces localisées (GeoJSON) sur une carte Leaflet centrée sur Rennes
+(function () {
+  var container = document.getElementById("map");
+  if (!container || typeof L === "undefined") {
+    return;
+  }
+
+  var map = L.map(container).setView([48.1113, -1.68], 12);
+  L.tileLayer("https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png", {
+    maxZoom: 19,
+    attribution: "&copy; OpenStreetMap",
+  }).addTo(map);
+
+  function escapeHTML(value) {
+    var div = document.createElement("div");
+    div.textContent = value == null ? "" : String(value);
+    return div.innerHTML;
+  }
+
+  function popup(properties) {
+    var lines = ["<strong>" + escapeHTML(properties.title || properties.reference) + "</strong>", escapeHTML(properties.agency)];
+    if (properties.price) {
+      lines.push(escapeHTML(properties.price) + " €");
+    }
+    if (properties.surface) {
+      lines.push(escapeHTML(properties.surface) + " m²");
+    }
+    var detail = "/dashboard/announcements/" + encodeURIComponent(properties.agency) + "/" + encodeURIComponent(properties.reference) + "?transaction=" + encodeURIComponent(properties.transaction);
+    lines.push('<a href="' + detail + '">Chronologie</a>');
+    if (properties.url) {
+      lines.push('<a href="' + escapeHTML(properties.url) + '" target="_blank" rel="noopener">Annonce</a>');
+    }
+    return lines.join("<br>");
+  }
+
+  fetch(container.dataset.geojson)
+    .then(function (response) {
+      return response.json();
+    })
+    .then(function (collection) {
+      document.getElementById("map-count").textContent = collection.features.length + " annonce(s) localisée(s).";
+      if (collection.features.length === 0) {
+        return;
+      }
+
+      var layer = L.geoJSON(collection, {
+        onEachFeature: function (feature, marker) {
+          marker.bindPopup(popup(feature.properties));
+        },
+      }).addTo(map);
+      map.fitBounds(layer.getBounds(), { padding: [20, 20], maxZoom: 15 });
+    });
+})();
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Nombre maximal de pages de résultats parcourues par défaut sur un site WIA
+const DefaultWIAMaxPages = 10
+
+// Expressions régulières pour lire les champs des pages de détails WIA
+var (
+	wiaReferencePattern = regexp.MustCompile(`R[ée]f(?:[ée]rence)?\.?\s*:?\s*(.+)$`)
+	wiaSurfacePattern   = regexp.MustCompile(`(?i)surface`)
+	wiaRoomsPattern     = regexp.MustCompile(`(?i)pi[eè]ces?`)
+	wiaCityPattern      = regexp.MustCompile(`(?i)^\s*(?:ville|localisation|commune)\s*:?`)
+)
+
+/**
+ * WIAAdapter est un adaptateur pour les sites d'agences construits avec le plugin WordPress WIA
+ * (recherche AJAX action=load_search_results, liste div#liste_annonces, référence dans un p.ref).
+ * Une nouvelle agence sur ce plugin s'ajoute avec son URL de recherche et ses paramètres.
+ * Les catégories et les zones sont des identifiants propres à chaque site : elles ne sont pas tirées des critères de recherche.
+ * @property {string} BaseURL - L'URL de la page de recherche des locations (ex: https://www.pigeaultimmobilier.com/location/).
+ * @property {string} SaleURL - L'URL de la page de recherche des ventes, ventes non recherchées si vide.
+ * @property {url.Values} Params - Les paramètres de recherche propres à l'agence (catégories, zones, agences...).
+ * @property {string} TransactionParam - Le paramètre du type de transaction (location ou vente).
+ * @property {string} BedroomsParam - Le paramètre du nombre minimal de chambres, s'il existe sur le site.
+ * @property {int} MaxPages - Le nombre maximal de pages de résultats parcourues, DefaultWIAMaxPages si 0.
+ * @property {string} ReferenceSelector - Le sélecteur de la référence du bien, propre au gabarit du site (p.ref si vide) :
+ * les annonces similaires affichées sur la page ont aussi un p.ref.
+ */
+type WIAAdapter struct {
+	BaseURL           string
+	SaleURL           string
+	Params            url.Values
+	TransactionParam  string
+	BedroomsParam     string
+	MaxPages          int
+	ReferenceSelector string
+}
+
+/**
+ * wiaAdapters liste les agences dont le site utilise le plugin WIA.
+ */
+var wiaAdapters = map[Agency]WIAAdapter{
+	LaFrancaiseImmobiliere: {
+		BaseURL: "https://www.la-francaise-immobiliere.fr/location/",
+		Params: url.Values{
+			"categorie[]": {"27"},
+			"zone[]":      {"6212", "6204", "6214"},
+		},
+		TransactionParam:  "post_types",
+		BedroomsParam:     "nb_chambres_min",
+		ReferenceSelector: "p.ref.d-inline",
+	},
+	PigeaultImmobilier: {
+		BaseURL: "https://www.pigeaultimmobilier.com/location/",
+		Params: url.Values{
+			"sous-categorie[]": {"1455"},
+			"agences[]":        {"26548"},
+		},
+		TransactionParam:  "wia_6_type",
+		ReferenceSelector: "#top_infos p.ref",
+	},
+}
+
+/**
+ * SearchURL construit l'URL de la recherche AJAX à partir des critères, triée par date décroissante.
+ * @param {SearchCriteria} criteria - Les critères de recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Erreur si le site ne recherche pas ce type de transaction.
+ */
+func (adapter WIAAdapter) SearchURL(criteria SearchCriteria) (string, error) {
+	baseURL := adapter.BaseURL
+	if !criteria.isRent() {
+		if adapter.SaleURL == "" {
+			return "", fmt.Errorf("recherche de ventes non configurée pour ce site WIA")
+		}
+		baseURL = adapter.SaleURL
+	}
+
+	query := url.Values{}
+	for key, values := range adapter.Params {
+		query[key] = append([]string(nil), values...)
+	}
+	query.Set(adapter.TransactionParam, string(criteria.transaction()))
+	query.Set("prix_min", "0")
+	if criteria.maxBudget() > 0 {
+		query.Set("prix_max", formatAmount(criteria.maxBudget()))
+	}
+	if adapter.BedroomsParam != "" {
+		query.Set(adapter.BedroomsParam, strconv.Itoa(criteria.minBedrooms()))
+	}
+	query.Set("submitted", "1")
+	query.Set("action", "load_search_results")
+	query.Set("searchOnMap", "0")
+	if query.Get("o") == "" {
+		query.Set("o", "date-desc")
+	}
+
+	return baseURL + "?" + query.Encode(), nil
+}
+
+/**
+ * requestOptions déclare le traitement des requêtes du plugin : les résultats AJAX sont demandés depuis la page de recherche.
+ * @return {RequestOptions} - Les options des requêtes.
+ */
+func (adapter WIAAdapter) requestOptions() RequestOptions {
+	return RequestOptions{Referer: true}
+}
+
+/**
+ * setupMainPage configure le collecteur pour les pages de résultats et suit la pagination AJAX du plugin.
+ * @param {colly.Collector} collector - Le collecteur à configurer.
+ * @param {[]string} detailPageURLs - La liste des URLs des pages de détail.
+ * @return {void}
+ */
+func (adapter WIAAdapter) setupMainPage(collector *colly.Collector, detailPageURLs *[]string) {
+	maxPages := adapter.MaxPages
+	if maxPages == 0 {
+		maxPages = DefaultWIAMaxPages
+	}
+
+	// Utiliser un ensemble pour éviter les doublons entre les pages
+	seenURLs := make(map[string]struct{})
+	visitedPages := 1
+
+	collector.OnHTML("div#liste_annonces", func(e *colly.HTMLElement) {
+		e.ForEach("div.row article", func(_ int, article *colly.HTMLElement) {
+			href := article.ChildAttr("a[rel='bookmark']", "href")
+			if href == "" {
+				log.Println("Lien de détail introuvable dans cet article.")
+				return
+			}
+
+			fullURL := e.Request.AbsoluteURL(href)
+			if _, exists := seenURLs[fullURL]; !exists {
+				seenURLs[fullURL] = struct{}{}
+				*detailPageURLs = append(*detailPageURLs, fullURL)
+			}
+		})
+	})
+
+	// La pagination recharge les résultats en AJAX : suivre le lien "suivant" ou le numéro de la page suivante
+	collector.OnHTML("html", func(e *colly.HTMLElement) {
+		if visitedPages >= maxPages {
+			return
+		}
+
+		nextURL := wiaNextPageURL(e)
+		if nextURL == "" {
+			return
+		}
+
+		visitedPages++
+		// Le collecteur est limité à une profondeur de 1 : la page suivante est visitée comme une page principale
+		if err := collector.Visit(nextURL); err != nil {
+			log.Printf("Erreur lors de la visite de la page de résultats suivante : %v", err)
+		}
+	})
+}
+
+/**
+ * wiaNextPageURL retourne l'URL de la page de résultats suivante.
+ * @param {colly.HTMLElement} e - L'élément <html> de la page de résultats.
+ * @return {string} - L'URL de la page suivante, vide s'il n'y en a pas.
+ */
+func wiaNextPageURL(e *colly.HTMLElement) string {
+	if href := e.ChildAttr("a.next.page-numbers, .pagination a.next, a[rel='next']", "href"); href != "" && href != "#" {
+		return e.Request.AbsoluteURL(href)
+	}
+
+	// Les boutons de pagination AJAX portent le numéro de page dans data-page
+	current, err := strconv.Atoi(e.Request.URL.Query().Get("paged"))
+	if err != nil || current < 1 {
+		current = 1
+	}
+
+	var next string
+	e.ForEachWithBreak(".pagination [data-page], .pager [data-page]", func(_ int, link *colly.HTMLElement) bool {
+		page, err := strconv.Atoi(link.Attr("data-page"))
+		if err != nil || page != current+1 {
+			return true
+		}
+
+		// Partir de l'URL demandée, sans le paramètre d'invalidation du cache
+		pageURL, err := url.Parse(requestURL(e.Request))
+		if err != nil {
+			return false
+		}
+		query := pageURL.Query()
+		query.Set("paged", strconv.Itoa(page))
+		pageURL.RawQuery = query.Encode()
+		next = pageURL.String()
+		return false
+	})
+	return next
+}
+
+/**
+ * processDetailPages extrait la référence et les champs (titre, prix, surface, pièces, ville) des pages de détail.
+ * @param {colly.Collector} collector - Le collecteur à configurer.
+ * @param {[]Announcement} announcements - La liste des annonces à remplir.
+ * @return {void}
+ */
+func (adapter WIAAdapter) processDetailPages(collector *colly.Collector, announcements *[]Announcement) {
+	collector.OnHTML("html", func(detail *colly.HTMLElement) {
+		// Seul le premier élément est lu : ChildText joindrait les références des annonces similaires
+		selector := adapter.ReferenceSelector
+		if selector == "" {
+			selector = "p.ref"
+		}
+		fullValue := strings.Join(strings.Fields(detail.DOM.Find(selector).First().Text()), " ")
+
+		match := wiaReferencePattern.FindStringSubmatch(fullValue)
+		if match == nil {
+			log.Printf("Impossible de trouver la référence dans : %s", fullValue)
+			return
+		}
+
+		// La référence est le reste de l'élément, gardé entier même en plusieurs mots : normalizeReference la nettoie
+		announcement := Announcement{
+			propertyReference: strings.TrimSpace(match[1]),
+			url:               requestURL(detail.Request),
+			title:             strings.TrimSpace(detail.ChildText("h1")),
+			price:             firstPrice(detail.ChildText(".prix, .price, p.prix, span.prix")),
+		}
+
+		// Les caractéristiques sont listées sous la forme "Surface : 45 m²", "Pièces : 2", "Ville : Rennes"
+		detail.ForEach("#infos li, .criteres li, ul.caracteristiques li, #top_infos li", func(_ int, item *colly.HTMLElement) {
+			text := strings.Join(strings.Fields(item.Text), " ")
+			switch {
+			case announcement.surface == 0 && wiaSurfacePattern.MatchString(text):
+				announcement.surface = firstSurface(text)
+				if announcement.surface == 0 {
+					announcement.surface = parseFrenchNumber(stateNumberPattern.FindString(text))
+				}
+			case announcement.rooms == 0 && wiaRoomsPattern.MatchString(text):
+				announcement.rooms = int(parseFrenchNumber(stateNumberPattern.FindString(text)))
+			case announcement.city == "" && wiaCityPattern.MatchString(text):
+				announcement.city = strings.TrimSpace(wiaCityPattern.ReplaceAllString(text, ""))
+			}
+		})
+
+		*announcements = append(*announcements, announcement)
+	})
+}
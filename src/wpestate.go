@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// Valeurs par défaut de l'adaptateur WP Estate
+const (
+	DefaultWPEstateAjaxAction = "wpestate_custom_adv_ajax_filter_listings_search"
+	DefaultWPEstateMaxPages   = 10
+)
+
+// Expression régulière pour trouver le jeton de sécurité de la recherche AJAX dans les scripts du thème
+var wpEstateNoncePattern = regexp.MustCompile(`["']?(?:wpestate_ajax_filtering|ajax_filtering_nonce|security)["']?\s*:\s*["']([0-9a-f]{8,})["']`)
+
+/**
+ * WPEstateAdapter est un adaptateur pour les sites d'agences construits avec le thème WordPress WP Estate
+ * (liste div#listing_ajax_container, cartes div.listing_wrapper, tableau des caractéristiques sur les pages de détails).
+ * L'URL de recherche est celle de la recherche ; la pagination passe par le point d'accès AJAX du thème.
+ * @property {string} BaseURL - L'URL de la page des annonces (ex: https://agenceducolombier.com/annonces/).
+ * @property {string} AjaxAction - L'action AJAX de la recherche, DefaultWPEstateAjaxAction si vide.
+ * @property {int} MaxPages - Le nombre maximal de pages de résultats parcourues, DefaultWPEstateMaxPages si 0.
+ */
+type WPEstateAdapter struct {
+	BaseURL    string
+	AjaxAction string
+	MaxPages   int
+}
+
+/**
+ * wpEstateAdapters liste les agences dont le site utilise le thème WP Estate.
+ */
+var wpEstateAdapters = map[Agency]WPEstateAdapter{
+	AgenceDuColombier: {BaseURL: "https://agenceducolombier.com/annonces/"},
+}
+
+/**
+ * SearchURL construit l'URL de la recherche à partir des critères. Le formulaire du thème ne filtre pas par commune.
+ * @param {SearchCriteria} criteria - Les critères de recherche.
+ * @return {string} - L'URL de la page de résultats.
+ * @return {error} - Toujours nil.
+ */
+func (adapter WPEstateAdapter) SearchURL(criteria SearchCriteria) (string, error) {
+	action := "louer"
+	if !criteria.isRent() {
+		action = "acheter"
+	}
+	// Sans loyer maximal, la borne haute du formulaire du thème
+	priceMax := formatAmount(criteria.maxBudget())
+	if priceMax == "" {
+		priceMax = "6000000"
+	}
+	query := url.Values{
+		"filter_search_action[]": {action},
+		"nb-pieces":              {formatCount(criteria.MinRooms)},
+		"min-surface":            {formatAmount(criteria.MinSurface)},
+		"price_low":              {"0"},
+		"price_max":              {priceMax},
+		"submit":                 {"LANCER MA RECHERCHE"},
+	}
+	query["filter_search_type[]"] = criteria.propertyLabels(map[PropertyType]string{PropertyApartment: "appartement", PropertyHouse: "maison", PropertyParking: "parking"})
+	return adapter.BaseURL + "?" + query.Encode(), nil
+}
+
+/**
+ * requestOptions déclare le traitement des requêtes du thème : le point d'accès AJAX vérifie la page d'origine avec le jeton de sécurité.
+ * @return {RequestOptions} - Les options des requêtes.
+ */
+func (adapter WPEstateAdapter) requestOptions() RequestOptions {
+	return RequestOptions{Referer: true}
+}
+
+/**
+ * setupMainPage configure le collecteur pour la page de recherche et les pages suivantes, chargées en AJAX.
+ * @param {colly.Collector} collector - Le collecteur à configurer.
+ * @param {[]string} detailPageURLs - La liste des URLs des pages de détail.
+ * @return {void}
+ */
+func (adapter WPEstateAdapter) setupMainPage(collector *colly.Collector, detailPageURLs *[]string) {
+	ajaxAction := adapter.AjaxAction
+	if ajaxAction == "" {
+		ajaxAction = DefaultWPEstateAjaxAction
+	}
+	maxPages := adapter.MaxPages
+	if maxPages == 0 {
+		maxPages = DefaultWPEstateMaxPages
+	}
+
+	// Utiliser un ensemble pour éviter les doublons entre les pages
+	seenURLs := make(map[string]struct{})
+	addCards := func(document *goquery.Selection, base *url.URL) int {
+		count := 0
+		document.Find("div.listing_wrapper").Each(func(_ int, card *goquery.Selection) {
+			href, exists := card.Attr("data-link")
+			if !exists || href == "" {
+				href, _ = card.Find("a[href]").First().Attr("href")
+			}
+			if href == "" {
+				return
+			}
+
+			count++
+			if parsed, err := base.Parse(href); err == nil {
+				href = parsed.String()
+			}
+			if _, exists := seenURLs[href]; !exists {
+				seenURLs[href] = struct{}{}
+				*detailPageURLs = append(*detailPageURLs, href)
+			}
+		})
+		return count
+	}
+
+	// Paramètres de la recherche AJAX, lus sur la page de recherche
+	var ajaxURL string
+	var form map[string]string
+	page := 1
+
+	requestNextPage := func() {
+		if page >= maxPages || ajaxURL == "" {
+			return
+		}
+		page++
+		form["newpage"] = strconv.Itoa(page)
+		// Le collecteur est limité à une profondeur de 1 : la page suivante est demandée comme une page principale
+		if err := collector.Post(ajaxURL, form); err != nil {
+			log.Printf("Erreur lors de la demande de la page de résultats %d : %v", page, err)
+		}
+	}
+
+	collector.OnHTML("html", func(e *colly.HTMLElement) {
+		// Les réponses AJAX sont traitées par OnResponse
+		if strings.HasSuffix(e.Request.URL.Path, "/admin-ajax.php") || addCards(e.DOM, e.Request.URL) == 0 {
+			return
+		}
+
+		// Pas de pagination : toutes les annonces sont sur la première page
+		if e.DOM.Find("ul.pagination li a, ul.pagination_nojax li a").Length() == 0 {
+			return
+		}
+
+		ajaxURL = e.Request.AbsoluteURL("/wp-admin/admin-ajax.php")
+		form = map[string]string{"action": ajaxAction}
+		for key, values := range e.Request.URL.Query() {
+			if key != "_" && len(values) > 0 {
+				form[key] = values[0]
+			}
+		}
+		if nonce := e.ChildAttr("input#wpestate_ajax_filtering", "value"); nonce != "" {
+			form["security"] = nonce
+		} else if match := wpEstateNoncePattern.FindStringSubmatch(e.ChildText("script")); match != nil {
+			form["security"] = match[1]
+		}
+
+		requestNextPage()
+	})
+
+	// Le point d'accès AJAX retourne les cartes en JSON ({"cards": "<div ...>"}) ou directement en HTML
+	collector.OnResponse(func(r *colly.Response) {
+		if !strings.HasSuffix(r.Request.URL.Path, "/admin-ajax.php") {
+			return
+		}
+
+		cards := string(r.Body)
+		var payload map[string]any
+		if err := json.Unmarshal(r.Body, &payload); err == nil {
+			cards = ""
+			for _, key := range []string{"cards", "html", "to_show"} {
+				if value, ok := payload[key].(string); ok {
+					cards = value
+					break
+				}
+			}
+		}
+
+		document, err := goquery.NewDocumentFromReader(strings.NewReader(cards))
+		if err != nil {
+			log.Printf("Réponse AJAX illisible pour la page de résultats %d : %v", page, err)
+			return
+		}
+
+		// Une page sans carte marque la fin des résultats
+		if addCards(document.Selection, r.Request.URL) > 0 {
+			requestNextPage()
+		}
+	})
+}
+
+/**
+ * processDetailPages lit le tableau des caractéristiques du thème (REF, prix, taille, pièces, ville).
+ * @param {colly.Collector} collector - Le collecteur à configurer.
+ * @param {[]Announcement} announcements - La liste des annonces à remplir.
+ * @return {void}
+ */
+func (adapter WPEstateAdapter) processDetailPages(collector *colly.Collector, announcements *[]Announcement) {
+	collector.OnHTML("html", func(detail *colly.HTMLElement) {
+		announcement := Announcement{
+			url:   requestURL(detail.Request),
+			title: strings.TrimSpace(detail.ChildText("h1.entry-title, h1")),
+		}
+
+		// Chaque caractéristique est écrite "Libellé: valeur", avec le libellé souvent dans un <strong>
+		detail.ForEach("div.wpestate_estate_property_design_intext_details p, div.listing_detail, .property_custom_detail_wrapper", func(_ int, item *colly.HTMLElement) {
+			text := strings.Join(strings.Fields(item.Text), " ")
+			label, value, found := strings.Cut(text, ":")
+			if !found {
+				return
+			}
+			label = slugReplacer.Replace(strings.ToLower(strings.TrimSpace(label)))
+			value = strings.TrimSpace(value)
+
+			switch {
+			case announcement.propertyReference == "" && (label == "ref" || strings.Contains(label, "reference") || strings.Contains(label, "id-de-propriete")):
+				// La valeur est gardée entière : normalizeReference nettoie les références en plusieurs mots
+				announcement.propertyReference = value
+			case announcement.price == 0 && (strings.Contains(label, "prix") || strings.Contains(label, "price") || strings.Contains(label, "loyer")):
+				announcement.price = firstPrice(value)
+				if announcement.price == 0 {
+					announcement.price = parseFrenchNumber(stateNumberPattern.FindString(value))
+				}
+			case announcement.surface == 0 && (strings.Contains(label, "taille") || strings.Contains(label, "surface") || strings.Contains(label, "size")):
+				announcement.surface = parseFrenchNumber(strings.TrimRight(stateNumberPattern.FindString(value), " .,"))
+			case announcement.rooms == 0 && (strings.Contains(label, "pieces") || strings.Contains(label, "rooms")):
+				announcement.rooms = int(parseFrenchNumber(stateNumberPattern.FindString(value)))
+			case announcement.city == "" && (label == "ville" || label == "city"):
+				announcement.city = value
+			case announcement.agencyFees == 0 && strings.Contains(label, "honoraires"):
+				announcement.agencyFees = firstAgencyFees(announcement.price, "honoraires "+value)
+			case announcement.coOwnershipCharges == 0 && strings.Contains(label, "copropriete") && strings.Contains(label, "charges"):
+				announcement.coOwnershipCharges = parseFrenchNumber(stateNumberPattern.FindString(value))
+			case announcement.lots == 0 && strings.Contains(label, "lots"):
+				announcement.lots = int(parseFrenchNumber(stateNumberPattern.FindString(value)))
+			case announcement.energyClass == "" && (strings.Contains(label, "dpe") || strings.Contains(label, "classe-energie")):
+				announcement.energyClass = firstEnergyClass("DPE " + strings.ToUpper(value))
+			}
+		})
+
+		if announcement.propertyReference == "" {
+			log.Printf("Impossible de trouver la référence sur la page %s", announcement.url)
+			return
+		}
+
+		*announcements = append(*announcements, announcement)
+	})
+}